@@ -0,0 +1,431 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"path"
+	"slash-robot/abi"
+	"slash-robot/params"
+	"slash-robot/utils"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/urfave/cli/v2"
+)
+
+// Exit codes of the commands.
+const (
+	exitFailure  = 1 // the command failed
+	exitConfig   = 2 // the configuration or a flag is invalid
+	exitNetwork  = 3 // no endpoint is usable
+	exitRejected = 4 // the chain rejected the transaction
+)
+
+var (
+	timeoutFlag = &cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "How long to wait for a transaction to be mined",
+		Value: time.Minute,
+	}
+	depositFlag = &cli.Uint64Flag{
+		Name:  "deposit",
+		Usage: "Deposit paid to RelayerHub on registration, in BNB",
+		Value: 100,
+	}
+)
+
+func newApp() *cli.App {
+	return &cli.App{
+		Name:  "slash-robot",
+		Usage: "Report validators casting conflicting fast finality votes",
+		CommandNotFound: func(ctx *cli.Context, command string) {
+			fmt.Fprintf(ctx.App.ErrWriter, "Unknown command %q, see %s help\n", command, ctx.App.Name)
+			cli.OsExiter(exitConfig)
+		},
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "config", Usage: "YAML configuration file"},
+			&cli.StringFlag{Name: "network", Usage: "Network profile, overrides the configuration file: local, testnet or mainnet"},
+			&cli.StringFlag{Name: "client", Usage: "Gateways to the bsc protocol, a comma separated list in order of preference, overrides the configuration: bsc_testnet, bsc, geth_ws, geth_ipc or any endpoint URL"},
+			&cli.StringFlag{Name: "store", Usage: "Backend of the vote history, overrides the configuration: memory or leveldb"},
+			&cli.StringFlag{Name: "log-format", Usage: "Format of the logs written to stderr: logfmt, json or terminal", Value: "logfmt", EnvVars: []string{"SLASH_ROBOT_LOG_FORMAT"}},
+			&cli.StringFlag{Name: "log-level", Usage: "Lowest level logged: trace, debug, info, warn, error or crit", Value: "info", EnvVars: []string{"SLASH_ROBOT_LOG_LEVEL"}},
+		},
+		Before: func(ctx *cli.Context) error {
+			if err := utils.SetupLogging(ctx.App.ErrWriter, ctx.String("log-format"), ctx.String("log-level")); err != nil {
+				return cli.Exit(fmt.Sprint("Error setting up logging: ", err), exitConfig)
+			}
+			return nil
+		},
+		Commands: []*cli.Command{
+			{
+				Name:  "monitor",
+				Usage: "Watch the votes and report conflicting ones",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "register", Usage: "Register the relayer first if it is not yet", Value: true},
+					&cli.StringFlag{Name: "metrics-addr", Usage: "Address of the /metrics, /healthz and /readyz endpoints, overrides metrics_addr, empty disables them"},
+					depositFlag,
+					timeoutFlag,
+				},
+				Action: monitor,
+			},
+			{
+				Name:   "register-relayer",
+				Usage:  "Register the relayer at RelayerHub",
+				Flags:  []cli.Flag{depositFlag, timeoutFlag},
+				Action: registerRelayerCommand,
+			},
+			{
+				Name:   "unregister-relayer",
+				Usage:  "Unregister the relayer from RelayerHub, which returns its deposit",
+				Flags:  []cli.Flag{timeoutFlag},
+				Action: unregisterRelayerCommand,
+			},
+			{
+				Name:      "submit-evidence",
+				Usage:     "Submit queued evidence by hand, outside of the monitor",
+				ArgsUsage: "<evidence id>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "dry-run", Usage: "Only simulate the submission"},
+					timeoutFlag,
+				},
+				Action: submitEvidenceCommand,
+			},
+			{
+				Name:  "watch-finality",
+				Usage: "Follow the finalized head and fail if it ever goes back",
+				Action: func(ctx *cli.Context) error {
+					clients, err := readOnlyClients(ctx)
+					if err != nil {
+						return err
+					}
+					defer clients.Close()
+					if err := finalizedHeaderMonitorLoop(ctx.Context, clients); err != nil {
+						return cli.Exit(err, exitFailure)
+					}
+					background.Wait()
+					return nil
+				},
+			},
+			{
+				Name:  "head-stats",
+				Usage: "Count the heads received per update interval, saved to the data directory on interrupt",
+				Flags: []cli.Flag{
+					&cli.DurationFlag{Name: "interval", Usage: "Counting interval, overrides update_interval"},
+				},
+				Action: func(ctx *cli.Context) error {
+					clients, err := readOnlyClients(ctx)
+					if err != nil {
+						return err
+					}
+					defer clients.Close()
+					if ctx.IsSet("interval") {
+						params.UpdateInterval = ctx.Duration("interval")
+					}
+					if err := monitorHeader(ctx.Context, clients); err != nil {
+						return cli.Exit(err, exitFailure)
+					}
+					background.Wait()
+					return nil
+				},
+			},
+			{
+				Name:  "store",
+				Usage: "Work with the vote history",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "inspect",
+						Usage:     "Print the stored votes of a vote address, with the monitor stopped",
+						ArgsUsage: "<vote address>",
+						Flags: []cli.Flag{
+							&cli.Uint64Flag{Name: "from", Usage: "Lowest target number"},
+							&cli.Uint64Flag{Name: "to", Usage: "Highest target number", Value: math.MaxUint64},
+						},
+						Action: storeInspectCommand,
+					},
+				},
+			},
+			keyCommand,
+			{
+				Name:   "transfer-out",
+				Usage:  "Send a cross chain transfer through TokenHub, to give a devnet traffic",
+				Hidden: true,
+				Flags: []cli.Flag{
+					&cli.Uint64Flag{Name: "amount", Usage: "Amount in BNB", Value: 1},
+					timeoutFlag,
+				},
+				Action: func(ctx *cli.Context) error {
+					if err := loadConfig(ctx, true); err != nil {
+						return err
+					}
+					clients, err := dial()
+					if err != nil {
+						return err
+					}
+					defer clients.Close()
+					return txExit(transferOut(ctx.Context, clients.Client(), bnb(ctx.Uint64("amount")), ctx.Duration("timeout")))
+				},
+			},
+		},
+	}
+}
+
+// loadConfig loads and applies the configuration selected by the global flags.
+// withRelayer also loads the signer of the relayer, which only commands
+// sending transactions need.
+func loadConfig(ctx *cli.Context, withRelayer bool) error {
+	cfg, err := params.LoadConfig(ctx.String("config"), ctx.String("network"))
+	if err != nil {
+		return cli.Exit(fmt.Sprint("Error loading configuration: ", err), exitConfig)
+	}
+	if ctx.String("client") != "" {
+		cfg.Endpoints = utils.ParseEndpoints(ctx.String("client"))
+	}
+	if ctx.String("store") != "" {
+		cfg.VoteStore = ctx.String("store")
+	}
+	validate := cfg.ValidateChain
+	if withRelayer {
+		validate = cfg.Validate
+	}
+	if err := validate(); err != nil {
+		return cli.Exit(fmt.Sprint("Error loading configuration: ", err), exitConfig)
+	}
+	cfg.Apply()
+	utils.ApplyParams()
+	if !withRelayer {
+		log.Info("Loaded configuration", "network", cfg.Network, "chain", cfg.ChainID)
+		return nil
+	}
+	signer, err := utils.NewRelayerSigner(cfg.Relayer)
+	if err != nil {
+		return cli.Exit(fmt.Sprint("Error loading relayer signer: ", err), exitConfig)
+	}
+	utils.UseSigner(signer)
+	log.Info("Loaded configuration", "network", cfg.Network, "chain", cfg.ChainID, "relayer", cfg.Relayer.Address)
+	return nil
+}
+
+// dial connects to the configured endpoints.
+func dial() (*utils.ClientPool, error) {
+	clients, err := utils.NewClientPool(params.Endpoints)
+	if err != nil {
+		return nil, cli.Exit(fmt.Sprint("Error connecting to client: ", err), exitNetwork)
+	}
+	return clients, nil
+}
+
+// readOnlyClients loads the configuration without the relayer and connects.
+func readOnlyClients(ctx *cli.Context) (*utils.ClientPool, error) {
+	if err := loadConfig(ctx, false); err != nil {
+		return nil, err
+	}
+	clients, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	goBackground(func() { clients.Run(ctx.Context) })
+	return clients, nil
+}
+
+// revertedError is a mined transaction that failed.
+type revertedError struct {
+	tx common.Hash
+}
+
+func (e *revertedError) Error() string {
+	return fmt.Sprintf("transaction %s reverted", e.tx.Hex())
+}
+
+// txExit maps the error of sending a transaction to the exit code.
+func txExit(err error) error {
+	var reverted *revertedError
+	var revert *utils.EvidenceRevertError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &reverted), errors.As(err, &revert):
+		return cli.Exit(err, exitRejected)
+	}
+	return cli.Exit(err, exitFailure)
+}
+
+func bnb(n uint64) *big.Int {
+	return new(big.Int).Mul(new(big.Int).SetUint64(n), big.NewInt(1e18))
+}
+
+func relayerDeposit(ctx *cli.Context) *big.Int {
+	return bnb(ctx.Uint64("deposit"))
+}
+
+func registerRelayerCommand(ctx *cli.Context) error {
+	if err := loadConfig(ctx, true); err != nil {
+		return err
+	}
+	clients, err := dial()
+	if err != nil {
+		return err
+	}
+	defer clients.Close()
+	if err := registerRelayer(ctx.Context, clients.Client(), relayerDeposit(ctx), ctx.Duration("timeout")); err != nil {
+		return txExit(err)
+	}
+	fmt.Println("Relayer", utils.SlashAccount.Addr.Hex(), "registered")
+	return nil
+}
+
+func unregisterRelayerCommand(ctx *cli.Context) error {
+	if err := loadConfig(ctx, true); err != nil {
+		return err
+	}
+	clients, err := dial()
+	if err != nil {
+		return err
+	}
+	defer clients.Close()
+	client := clients.Client()
+	relayerHub, _ := abi.NewRelayerhub(utils.RelayerHubAddr, client)
+	registered, err := relayerHub.IsRelayer(&bind.CallOpts{}, utils.SlashAccount.Addr)
+	if err != nil {
+		return cli.Exit(fmt.Sprint("Error checking relayer: ", err), exitNetwork)
+	}
+	if !registered {
+		fmt.Println("Relayer", utils.SlashAccount.Addr.Hex(), "is not registered")
+		return nil
+	}
+	tx, err := relayerHub.Unregister(utils.TransactOpts(utils.SlashAccount.Signer, utils.ChainId))
+	if err != nil {
+		return cli.Exit(fmt.Sprint("Error unregister relayer: ", err), exitFailure)
+	}
+	fmt.Println("Unregistering relayer", utils.SlashAccount.Addr.Hex(), "in", tx.Hash().Hex())
+	if _, err := waitReceipt(ctx.Context, client, tx, ctx.Duration("timeout")); err != nil {
+		return txExit(err)
+	}
+	fmt.Println("Relayer unregistered, the deposit is returned once the unregister period passed")
+	return nil
+}
+
+// submitEvidenceCommand submits evidence of the queue by hand. It refuses to
+// run while a monitor holds the data directory. The transaction is recorded in
+// the queue, where the next monitor finds its outcome.
+func submitEvidenceCommand(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return cli.Exit("Usage: submit-evidence <evidence id>", exitConfig)
+	}
+	id, err := hexutil.Decode(ctx.Args().First())
+	if err != nil || len(id) != common.HashLength {
+		return cli.Exit(fmt.Sprintf("Invalid evidence id %q", ctx.Args().First()), exitConfig)
+	}
+	if err := loadConfig(ctx, true); err != nil {
+		return err
+	}
+	lock, err := utils.LockDataDir(params.RecordFilePath)
+	if err != nil {
+		return cli.Exit(fmt.Sprint("Error locking data directory, stop the monitor first: ", err), exitConfig)
+	}
+	defer lock.Release()
+	queue, err := utils.NewEvidenceQueue(path.Join(params.RecordFilePath, "evidence"))
+	if err != nil {
+		return cli.Exit(fmt.Sprint("Error opening evidence queue: ", err), exitFailure)
+	}
+	evidence, ok := queue.Get(common.BytesToHash(id))
+	if !ok {
+		return cli.Exit(fmt.Sprint("No evidence ", ctx.Args().First()), exitConfig)
+	}
+	switch evidence.Status {
+	case utils.EvidenceSubmitted, utils.EvidenceIncluded, utils.EvidenceSettled:
+		return cli.Exit(fmt.Sprint("Evidence already ", evidence.Status, " in ", evidence.TxHash.Hex()), exitConfig)
+	}
+	clients, err := dial()
+	if err != nil {
+		return err
+	}
+	defer clients.Close()
+	client := clients.Client()
+
+	if err := utils.SimulateEvidence(client, utils.SlashAccount.Addr, evidence.VoteA, evidence.VoteB); err != nil {
+		return txExit(err)
+	}
+	fmt.Println("Evidence simulated successfully")
+	if ctx.Bool("dry-run") {
+		return nil
+	}
+	tx, err := utils.ReportVote(evidence.VoteA, evidence.VoteB, client)
+	if err != nil {
+		return cli.Exit(fmt.Sprint("Error submitting evidence: ", err), exitFailure)
+	}
+	fmt.Println("Evidence submitted in", tx.Hash().Hex())
+	evidence.Status = utils.EvidenceSubmitted
+	evidence.TxHash = tx.Hash()
+	evidence.TxHashes = append(evidence.TxHashes, tx.Hash())
+	evidence.Nonce = tx.Nonce()
+	evidence.Attempts++
+	evidence.SubmittedAt = time.Now()
+	if head, err := client.BlockNumber(ctx.Context); err == nil {
+		evidence.SubmittedBlock = head
+	}
+	evidence.LastError = ""
+	if err := queue.Update(evidence); err != nil {
+		return cli.Exit(fmt.Sprint("Error recording the transaction in the evidence queue: ", err), exitFailure)
+	}
+	rc, err := waitReceipt(ctx.Context, client, tx, ctx.Duration("timeout"))
+	if err != nil {
+		return txExit(err)
+	}
+	outcome, err := utils.ParseSlashOutcome(rc)
+	if err != nil {
+		return cli.Exit(fmt.Sprint("Error reading slash outcome: ", err), exitFailure)
+	}
+	if !outcome.Slashes(evidence.Validator) {
+		return cli.Exit(fmt.Sprint("Evidence included, but ", evidence.Validator.Hex(), " was not slashed"), exitRejected)
+	}
+	fmt.Println("Validator", evidence.Validator.Hex(), "slashed in block", rc.BlockNumber)
+	return nil
+}
+
+func storeInspectCommand(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return cli.Exit("Usage: store inspect <vote address>", exitConfig)
+	}
+	voteAddr, err := hexutil.Decode(ctx.Args().First())
+	if err != nil || len(voteAddr) != types.BLSPublicKeyLength {
+		return cli.Exit(fmt.Sprintf("Invalid vote address %q", ctx.Args().First()), exitConfig)
+	}
+	if err := loadConfig(ctx, false); err != nil {
+		return err
+	}
+	// opening the store replays and checkpoints it, which must not happen
+	// under a running monitor
+	lock, err := utils.LockDataDir(params.RecordFilePath)
+	if err != nil {
+		return cli.Exit(fmt.Sprint("Error locking data directory, stop the monitor first: ", err), exitConfig)
+	}
+	defer lock.Release()
+	voteStore, err := utils.NewVoteStore(params.VoteStoreBackend, params.RecordFilePath)
+	if err != nil {
+		return cli.Exit(fmt.Sprint("Error opening vote store: ", err), exitFailure)
+	}
+	defer voteStore.Close()
+
+	var addr types.BLSPublicKey
+	copy(addr[:], voteAddr)
+	count := 0
+	err = voteStore.RangeByTarget(addr, ctx.Uint64("from"), ctx.Uint64("to"), func(stored *utils.StoredVote) bool {
+		count++
+		fmt.Printf("target %d (%s) source %d (%s) validator %s\n",
+			stored.Vote.Data.TargetNumber, stored.Vote.Data.TargetHash.Hex(),
+			stored.Vote.Data.SourceNumber, stored.Vote.Data.SourceHash.Hex(),
+			stored.Validator.Hex())
+		return true
+	})
+	if err != nil {
+		return cli.Exit(fmt.Sprint("Error reading vote store: ", err), exitFailure)
+	}
+	fmt.Println(count, "votes")
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slash-robot/params"
+	"slash-robot/utils"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/urfave/cli/v2"
+)
+
+var keyFlags = []cli.Flag{
+	&cli.StringFlag{Name: "keystore", Usage: "Keystore directory", Value: path.Join(params.RecordFilePath, "keystore")},
+	&cli.StringFlag{Name: "password-file", Usage: "File holding the keystore passphrase, SLASH_ROBOT_RELAYER_PASSWORD is read otherwise"},
+}
+
+// keyCommand creates or imports the relayer key into an encrypted keystore,
+// whose file is then configured as relayer.keystore.
+var keyCommand = &cli.Command{
+	Name:  "key",
+	Usage: "Write the relayer key into an encrypted keystore",
+	Subcommands: []*cli.Command{
+		{
+			Name:  "new",
+			Usage: "Create a new relayer key",
+			Flags: keyFlags,
+			Action: func(ctx *cli.Context) error {
+				return writeKey(ctx, func(ks *keystore.KeyStore, password string) (accounts.Account, error) {
+					return ks.NewAccount(password)
+				})
+			},
+		},
+		{
+			Name:      "import",
+			Usage:     "Import a hex encoded relayer key from a file",
+			ArgsUsage: "<hex key file>",
+			Flags:     keyFlags,
+			Action: func(ctx *cli.Context) error {
+				if ctx.NArg() != 1 {
+					return cli.Exit("Usage: key import <hex key file>", exitConfig)
+				}
+				key, err := crypto.LoadECDSA(ctx.Args().First())
+				if err != nil {
+					return cli.Exit(fmt.Sprint("Error reading key: ", err), exitConfig)
+				}
+				return writeKey(ctx, func(ks *keystore.KeyStore, password string) (accounts.Account, error) {
+					return ks.ImportECDSA(key, password)
+				})
+			},
+		},
+	},
+}
+
+func writeKey(ctx *cli.Context, write func(*keystore.KeyStore, string) (accounts.Account, error)) error {
+	password, err := utils.RelayerPassword(params.Relayer{PasswordFile: ctx.String("password-file"), Password: os.Getenv("SLASH_ROBOT_RELAYER_PASSWORD")})
+	if err != nil {
+		return cli.Exit(fmt.Sprint("Error reading password: ", err), exitConfig)
+	}
+	ks := keystore.NewKeyStore(ctx.String("keystore"), keystore.StandardScryptN, keystore.StandardScryptP)
+	account, err := write(ks, password)
+	if err != nil {
+		return cli.Exit(fmt.Sprint("Error writing keystore: ", err), exitFailure)
+	}
+	fmt.Println("Address: ", account.Address.Hex())
+	fmt.Println("Keystore:", account.URL.Path)
+	return nil
+}
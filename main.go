@@ -2,11 +2,8 @@ package main
 
 import (
 	"context"
-	"encoding/hex"
 	"encoding/json"
-	"flag"
 	"fmt"
-	"log"
 	"math/big"
 	"os"
 	"os/signal"
@@ -14,144 +11,313 @@ import (
 	"slash-robot/abi"
 	"slash-robot/params"
 	"slash-robot/utils"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/urfave/cli/v2"
 )
 
-func voteMonitorLoop(client *ethclient.Client, vrStore *utils.VotesRecordStore) {
-	newVoteChannel := make(chan *types.VoteEnvelope)
-	sub, err := client.SubscribeNewVotes(context.Background(), newVoteChannel)
-	defer sub.Unsubscribe()
+// Loggers of the components run by the commands.
+var (
+	detectorLog     = utils.Logger("detector")
+	storeLog        = utils.Logger("store")
+	subscriptionLog = utils.Logger("subscription")
+	validatorsLog   = utils.Logger("validators")
+	relayerLog      = utils.Logger("relayer")
+)
+
+// background tracks the goroutines that have to finish before the clients are
+// closed on shutdown.
+var background sync.WaitGroup
+
+// notifier alerts the webhooks of the monitor; it is nil for the other
+// commands, which drops the notifications.
+var notifier *utils.Notifier
 
+// goBackground runs f in a goroutine tracked by background.
+func goBackground(f func()) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		f()
+	}()
+}
+
+// supervise opens a subscription and keeps it alive in the background until
+// ctx is done. If the first attempt fails, the supervisor keeps retrying.
+// Long gaps between notifications are alerted.
+func supervise(ctx context.Context, name string, stallTimeout time.Duration, subscribe utils.SubscribeFunc) *utils.SubscriptionSupervisor {
+	supervisor := utils.NewSubscriptionSupervisor(name, stallTimeout, subscribe)
+	supervisor.OnGapOpen = func(lastSeen time.Time) { notifier.Gap(name, lastSeen) }
+	supervisor.OnGapClosed = func(lastSeen time.Time) { notifier.GapResolved(name, lastSeen) }
+	sub, err := supervisor.Subscribe()
 	if err != nil {
-		log.Fatal("error while subscribing new vote: ", err)
-	} else {
-		fmt.Println("Subscribed to new vote")
+		subscriptionLog.Warn("Subscribe failed, retrying", "subscription", name, "err", err)
+	}
+	goBackground(func() { supervisor.Run(ctx, sub) })
+	return supervisor
+}
+
+// voteMonitorLoop subscribes to the votes of every endpoint, since each node
+// only sees the votes gossiped to it, and checks each vote once.
+func voteMonitorLoop(ctx context.Context, clients *utils.ClientPool, voteStore utils.VoteStore, validators *utils.ValidatorSet, queue *utils.EvidenceQueue, backfilledVoteChannel <-chan *utils.BackfilledVote) {
+	newVoteChannel := make(chan *types.VoteEnvelope)
+	// the vote feed is only alerted as down when no endpoint delivers votes
+	voteGap := notifier.FeedGap("votes", clients.Len())
+	for i := 0; i < clients.Len(); i++ {
+		i := i
+		endpointVoteChannel := make(chan *types.VoteEnvelope)
+		name := fmt.Sprintf("votes/%d", i)
+		votes := utils.NewSubscriptionSupervisor(name, params.SubscriptionStallTimeout, func(ctx context.Context) (ethereum.Subscription, error) {
+			client, err := clients.Endpoint(i)
+			if err != nil {
+				return nil, err
+			}
+			return client.SubscribeNewVotes(ctx, endpointVoteChannel)
+		})
+		votes.OnGapOpen = func(lastSeen time.Time) { voteGap.Open(i, lastSeen) }
+		votes.OnGapClosed = func(time.Time) { voteGap.Closed(i) }
+		sub, err := votes.Subscribe()
+		if err != nil {
+			subscriptionLog.Warn("Subscribe failed, retrying", "subscription", name, "err", err)
+		}
+		goBackground(func() { votes.Run(ctx, sub) })
+		goBackground(func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case vote := <-endpointVoteChannel:
+					votes.Alive()
+					select {
+					case newVoteChannel <- vote:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		})
+	}
+	dedup := utils.NewVoteDeduplicator(params.VoteDedupSize)
+	invalidVoteLog := utils.NewLogLimiter(params.InvalidVoteLogRate)
+
+	detect := func(vote *types.VoteEnvelope, validator common.Address) {
+		ok, violation := utils.CheckVote(vote, validator, voteStore)
+		if ok {
+			return
+		}
+		notifier.Violation(violation)
+		if !violation.Provable() {
+			detectorLog.Info("No evidence queued, vote only known from a block attestation", violation.LogCtx()...)
+			return
+		}
+		evidence, added, err := queue.Add(violation)
+		if err != nil {
+			detectorLog.Error("Failed to queue evidence", append(violation.LogCtx(), "err", err)...)
+			return
+		}
+		if added {
+			detectorLog.Info("Evidence queued", evidence.LogCtx()...)
+		}
 	}
 
-	c := make(chan os.Signal, 0)
-	signal.Notify(c)
-	//var startNum uint64 = 0
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case vote := <-newVoteChannel:
-			//if startNum == 0 {
-			//	startNum = vote.Data.SourceNumber
-			//}
-			//if vote.Data.SourceNumber == startNum+5 {
-			//	fmt.Println("test slash")
-			//	utils.TestSlash(vote, client)
-			//}
-			ok, height := utils.CheckVote(vote, vrStore)
+			if dedup.Seen(vote) {
+				continue
+			}
+			// the set lookup is cheap, the BLS verification is not
+			validator, ok := validators.Voter(vote)
 			if !ok {
-				vote2 := vrStore.VoteRecord[vote.VoteAddress][height]
-				fmt.Println("--------------bad vote detected!--------------")
-				fmt.Println("vote address:", vote.VoteAddress)
-				fmt.Println("vote message:", vote2.Data)
-				utils.ReportVote(vote, vote2, client)
+				continue
 			}
-		case s := <-c:
-			if s == os.Interrupt || s == os.Kill {
-				if _, err := os.Stat(vrStore.FileDir); os.IsNotExist(err) {
-					err := os.MkdirAll(vrStore.FileDir, os.ModePerm)
-					if err != nil {
-						log.Fatal("Error create data dir:", err)
-					}
-				}
-				for val, record := range vrStore.VoteRecord {
-					filePath := path.Join(vrStore.FileDir, hex.EncodeToString(val.Bytes()))
-					f, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, os.ModePerm)
-					if err != nil {
-						log.Fatal("Error saveLoop VotesRecordStore:", err)
-					}
-					e := json.NewEncoder(f)
-					if err := e.Encode(record); err != nil {
-						log.Fatal("Error saving vrStore:", err)
-					}
-					_ = f.Close()
+			if err := utils.VerifyVote(vote); err != nil {
+				if ok, suppressed := invalidVoteLog.Allow(); ok {
+					detectorLog.Warn("Dropped invalid vote", "vote_address", common.Bytes2Hex(vote.VoteAddress.Bytes()), "err", err, "suppressed", suppressed)
 				}
-				os.Exit(0)
+				continue
 			}
+			// only genuine votes of the validator set count as the feed being
+			// alive for /readyz
+			utils.ObserveVote(vote, validator)
+			detect(vote, validator)
+		case backfilled := <-backfilledVoteChannel:
+			detect(backfilled.Vote, backfilled.Validator)
 		}
 
 	}
 }
 
-func finalizedHeaderMonitorLoop(client *ethclient.Client) {
+// finalizedHeaderMonitorLoop follows the finalized head until ctx is done, and
+// fails if it ever goes back.
+func finalizedHeaderMonitorLoop(ctx context.Context, clients *utils.ClientPool) error {
 	newFinalizedHeaderChannel := make(chan *types.Header)
-	sub, err := client.SubscribeNewFinalizedHeader(context.Background(), newFinalizedHeaderChannel)
-	defer sub.Unsubscribe()
-
-	if err != nil {
-		log.Fatal("error while subscribing finalized header: ", err)
-	} else {
-		fmt.Println("Subscribed to finalized header")
-	}
+	finalizedHeaders := supervise(ctx, "finalized_headers", params.SubscriptionStallTimeout, func(ctx context.Context) (ethereum.Subscription, error) {
+		return clients.Client().SubscribeNewFinalizedHeader(ctx, newFinalizedHeaderChannel)
+	})
 
 	var preFinalizedHeight uint64
 	var finalizedHeights []uint64
 	for {
-		header := <-newFinalizedHeaderChannel
+		var header *types.Header
+		select {
+		case <-ctx.Done():
+			return nil
+		case header = <-newFinalizedHeaderChannel:
+		}
+		finalizedHeaders.Alive()
 		if height := header.Number.Uint64(); height >= preFinalizedHeight {
 			preFinalizedHeight = height
 			finalizedHeights = append(finalizedHeights, height)
 		} else {
-			log.Fatal("Finalized height decline: ", finalizedHeights[len(finalizedHeights)-10:])
+			if len(finalizedHeights) > 10 {
+				finalizedHeights = finalizedHeights[len(finalizedHeights)-10:]
+			}
+			return fmt.Errorf("finalized height declined to %d after %v", height, finalizedHeights)
 		}
 	}
 }
 
-func registerRelayer(client *ethclient.Client) {
-	account := utils.SlashAccount
-	account.Key, _ = crypto.HexToECDSA(account.RawKey)
-	relayerHub, _ := abi.NewRelayerhub(utils.RelayerHubAddr, client)
+// finalizedLoop prunes the vote store, settles included evidence and
+// backfills votes from attestations as the finalized head advances.
+func finalizedLoop(ctx context.Context, clients *utils.ClientPool, voteStore utils.VoteStore, submitter *utils.Submitter, backfiller *utils.Backfiller) {
+	newFinalizedHeaderChannel := make(chan *types.Header)
+	finalizedHeaders := supervise(ctx, "finalized_headers", params.SubscriptionStallTimeout, func(ctx context.Context) (ethereum.Subscription, error) {
+		return clients.Client().SubscribeNewFinalizedHeader(ctx, newFinalizedHeaderChannel)
+	})
 
-	out, err := relayerHub.IsRelayer(&bind.CallOpts{}, account.Addr)
-	if err != nil {
-		log.Fatal("Error register relayer:", err)
+	for {
+		var header *types.Header
+		select {
+		case <-ctx.Done():
+			return
+		case header = <-newFinalizedHeaderChannel:
+		}
+		finalizedHeaders.Alive()
+		utils.ObserveFinalized(header)
+		submitter.Finalized(header)
+		backfiller.Finalized(header)
+		finalized := header.Number.Uint64()
+		pruned, err := utils.PruneVotes(voteStore, finalized, params.PruneSafetyMargin)
+		if err != nil {
+			storeLog.Error("Failed to prune vote store", "finalized", finalized, "err", err)
+		} else if pruned > 0 {
+			storeLog.Info("Pruned votes", "count", pruned, "below", utils.PruneHeight(finalized, params.PruneSafetyMargin))
+		}
 	}
+}
 
-	if !out {
-		ops, _ := bind.NewKeyedTransactorWithChainID(account.Key, utils.ChainId)
-		ops.Value = new(big.Int).Mul(big.NewInt(1e18), big.NewInt(100))
-		tx, err := relayerHub.Register(ops)
+func validatorSetLoop(ctx context.Context, clients *utils.ClientPool, validators *utils.ValidatorSet) {
+	newHeadChannel := make(chan *types.Header)
+	heads := supervise(ctx, "heads", params.SubscriptionStallTimeout, func(ctx context.Context) (ethereum.Subscription, error) {
+		return clients.Client().SubscribeNewHead(ctx, newHeadChannel)
+	})
+
+	updatedChannel := make(chan *abi.ValidatorsetValidatorSetUpdated)
+	supervise(ctx, "validator_set_updates", 0, func(ctx context.Context) (ethereum.Subscription, error) {
+		validatorSet, err := abi.NewValidatorsetFilterer(utils.ValidatorSetAddr, clients.Client())
 		if err != nil {
-			log.Fatal("Error register relayer:", err)
-		}
-		var rc *types.Receipt
-		for i := 0; i < 180; i++ {
-			rc, err = client.TransactionReceipt(context.Background(), tx.Hash())
-			if err == nil && rc.Status != 0 {
-				break
-			} else if rc != nil && rc.Status == 0 {
-				log.Fatal("Register relayer failed")
+			return nil, err
+		}
+		return validatorSet.WatchValidatorSetUpdated(&bind.WatchOpts{Context: ctx}, updatedChannel)
+	})
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case head := <-newHeadChannel:
+			heads.Alive()
+			utils.ObserveHead(head)
+			if head.Number.Uint64()%params.EpochLength != 0 {
+				continue
 			}
-			time.Sleep(100 * time.Millisecond)
+		case <-updatedChannel:
 		}
-		if rc == nil {
-			log.Fatal("Register relayer failed")
+		if err := validators.Refresh(); err != nil {
+			validatorsLog.Warn("Failed to refresh validator set", "err", err)
+		} else {
+			validatorsLog.Info("Validator set refreshed", "validators", validators.Len())
 		}
 	}
 }
 
-func monitorHeader(client *ethclient.Client) {
-	newHeadChannel := make(chan *types.Header)
-	sub, err := client.SubscribeNewHead(context.Background(), newHeadChannel)
-	defer sub.Unsubscribe()
+// relayerLoop checks the balance and registration of the relayer, for the
+// metrics and readiness, until ctx is done.
+func relayerLoop(ctx context.Context, clients *utils.ClientPool) {
+	ticker := time.NewTicker(params.RelayerCheckInterval)
+	defer ticker.Stop()
+	for {
+		if err := utils.UpdateRelayerBalance(clients.Client(), utils.SlashAccount.Addr); err != nil {
+			relayerLog.Warn("Failed to read relayer balance", "relayer", utils.SlashAccount.Addr.Hex(), "err", err)
+		}
+		if err := utils.UpdateRelayerRegistration(clients, utils.SlashAccount.Addr); err != nil {
+			relayerLog.Warn("Failed to check relayer registration", "relayer", utils.SlashAccount.Addr.Hex(), "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
 
+// registerRelayer registers the relayer at RelayerHub, paying deposit, unless
+// it is registered already.
+func registerRelayer(ctx context.Context, client *ethclient.Client, deposit *big.Int, timeout time.Duration) error {
+	account := utils.SlashAccount
+	relayerHub, _ := abi.NewRelayerhub(utils.RelayerHubAddr, client)
+
+	out, err := relayerHub.IsRelayer(&bind.CallOpts{}, account.Addr)
 	if err != nil {
-		log.Fatal("Error while subscribing new head: ", err)
-	} else {
-		fmt.Println("Subscribed to new head")
+		return fmt.Errorf("error checking relayer: %v", err)
+	}
+	if out {
+		return nil
 	}
 
-	c := make(chan os.Signal, 0)
-	signal.Notify(c)
+	ops := utils.TransactOpts(account.Signer, utils.ChainId)
+	ops.Value = deposit
+	tx, err := relayerHub.Register(ops)
+	if err != nil {
+		return fmt.Errorf("error register relayer: %v", err)
+	}
+	relayerLog.Info("Registering relayer", "relayer", account.Addr.Hex(), "tx", tx.Hash().Hex())
+	_, err = waitReceipt(ctx, client, tx, timeout)
+	return err
+}
+
+// waitReceipt waits up to timeout for tx to be mined, and fails if it reverted.
+func waitReceipt(ctx context.Context, client *ethclient.Client, tx *types.Transaction, timeout time.Duration) (*types.Receipt, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	rc, err := bind.WaitMined(ctx, client, tx)
+	if err != nil {
+		return nil, fmt.Errorf("transaction %s not mined: %v", tx.Hash().Hex(), err)
+	}
+	if rc.Status == types.ReceiptStatusFailed {
+		return rc, &revertedError{tx.Hash()}
+	}
+	return rc, nil
+}
+
+// monitorHeader counts the heads received per update interval until ctx is
+// done, and then saves the counts to the data directory.
+func monitorHeader(ctx context.Context, clients *utils.ClientPool) error {
+	newHeadChannel := make(chan *types.Header)
+	heads := supervise(ctx, "heads", params.SubscriptionStallTimeout, func(ctx context.Context) (ethereum.Subscription, error) {
+		return clients.Client().SubscribeNewHead(ctx, newHeadChannel)
+	})
 
 	ticker := time.NewTicker(params.UpdateInterval)
 	defer ticker.Stop()
@@ -165,80 +331,156 @@ func monitorHeader(client *ethclient.Client) {
 	for {
 		select {
 		case head := <-newHeadChannel:
-			fmt.Println("New head at height:", head.Number.Uint64())
+			heads.Alive()
+			log.Debug("New head", "number", head.Number.Uint64())
 			count += 1
 		case <-ticker.C:
-			fmt.Printf("\n--------%d Heads Received Last Minute--------\n\n", count)
+			log.Info("Heads received", "count", count, "interval", params.UpdateInterval)
 			cr.Record = append(cr.Record, count)
 			cr.Average += count
 			count = 0
-		case s := <-c:
-			if s == os.Interrupt || s == os.Kill {
+		case <-ctx.Done():
+			if len(cr.Record) > 0 {
 				cr.Average = cr.Average / len(cr.Record)
-				filePath := path.Join("./data/", time.Now().String()+".json")
-				f, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, os.ModePerm)
-				if err != nil {
-					log.Fatal("Error saving countRecord:", err)
-				}
-				e := json.NewEncoder(f)
-				if err := e.Encode(cr); err != nil {
-					log.Fatal("Error saving countRecord:", err)
-				}
-				_ = f.Close()
-				os.Exit(0)
 			}
+			filePath := path.Join(params.RecordFilePath, time.Now().String()+".json")
+			f, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+			if err != nil {
+				return fmt.Errorf("error saving countRecord: %v", err)
+			}
+			defer f.Close()
+			return json.NewEncoder(f).Encode(cr)
 		}
 
 	}
 }
 
-func callContract(client *ethclient.Client) {
+// transferOut sends amount across the chain through TokenHub, which gives a
+// devnet some traffic.
+func transferOut(ctx context.Context, client *ethclient.Client, amount *big.Int, timeout time.Duration) error {
 	account := utils.SlashAccount
-	account.Key, _ = crypto.HexToECDSA(account.RawKey)
 	tokenHub, _ := abi.NewTokenhub(utils.TokenHubAddr, client)
 
-	ops, _ := bind.NewKeyedTransactorWithChainID(account.Key, utils.ChainId)
-	ops.Value = new(big.Int).Mul(big.NewInt(1e18), big.NewInt(2))
+	ops := utils.TransactOpts(account.Signer, utils.ChainId)
+	ops.Value = new(big.Int).Add(amount, big.NewInt(1e18))
 	tx, err := tokenHub.TransferOut(
 		ops,
 		common.HexToAddress("0x0000000000000000000000000000000000000000"),
 		common.HexToAddress("0xC0853E5C6b9Fa64F05D1eAc460a8beA48cDA9d63"),
-		big.NewInt(1e18),
+		amount,
 		150000+uint64(time.Now().Unix()))
 	if err != nil {
-		log.Fatal("Error call contract:", err)
+		return fmt.Errorf("error call contract: %v", err)
 	}
-	var rc *types.Receipt
-	for i := 0; i < 180; i++ {
-		rc, err = client.TransactionReceipt(context.Background(), tx.Hash())
-		if err == nil && rc.Status != 0 {
-			break
-		} else if rc != nil && rc.Status == 0 {
-			log.Fatal("Error call contract", rc.Logs)
+	if _, err := waitReceipt(ctx, client, tx, timeout); err != nil {
+		return err
+	}
+	fmt.Println("Transaction success")
+	return nil
+}
+
+// monitor watches the votes and reports the violations found until
+// interrupted. It then waits for every loop to stop and flush its state.
+func monitor(ctx *cli.Context) error {
+	if err := loadConfig(ctx, true); err != nil {
+		return err
+	}
+	if err := params.ValidateSubscriptions(params.Endpoints); err != nil {
+		return cli.Exit(fmt.Sprint("Error loading configuration: ", err), exitConfig)
+	}
+	if ctx.IsSet("metrics-addr") {
+		params.MetricsAddr = ctx.String("metrics-addr")
+	}
+	lock, err := utils.LockDataDir(params.RecordFilePath)
+	if err != nil {
+		return cli.Exit(fmt.Sprint("Error locking data directory: ", err), exitConfig)
+	}
+	defer lock.Release()
+	if notifier, err = utils.NewNotifier(params.Webhooks); err != nil {
+		return cli.Exit(fmt.Sprint("Error loading notifier: ", err), exitConfig)
+	}
+	// the notifier outlives the other loops, so that the alerts they raise
+	// while stopping are still posted
+	notifyCtx, stopNotifier := context.WithCancel(context.Background())
+	notifierDone := make(chan struct{})
+	go func() {
+		defer close(notifierDone)
+		notifier.Run(notifyCtx)
+	}()
+	defer func() {
+		stopNotifier()
+		<-notifierDone
+	}()
+	if params.MetricsAddr != "" {
+		if _, err := utils.ServeStatus(ctx.Context, params.MetricsAddr); err != nil {
+			return cli.Exit(fmt.Sprint("Error serving metrics and health: ", err), exitConfig)
 		}
-		time.Sleep(100 * time.Millisecond)
 	}
-	if rc == nil {
-		log.Fatal("Transaction failed")
-	} else {
-		fmt.Println("Transaction success")
+	// endpoints serving another chain id fail the health check, so the robot
+	// never signs for the wrong chain
+	clients, err := dial()
+	if err != nil {
+		return err
 	}
+	defer clients.Close()
+	goBackground(func() { clients.Run(ctx.Context) })
 
-}
-
-func main() {
-	clientEntered := flag.String("client", "geth_ws", "Gateway to the bsc protocol. Available options:\n\t-bsc_testnet\n\t-bsc\n\t-geth_ws\n\t-geth_ipc")
-	flag.Parse()
+	if ctx.Bool("register") {
+		if err := registerRelayer(ctx.Context, clients.Client(), relayerDeposit(ctx), ctx.Duration("timeout")); err != nil {
+			return txExit(err)
+		}
+	}
 
-	client := utils.GetCurrentClient(*clientEntered)
-	defer client.Close()
+	voteStore, err := utils.NewVoteStore(params.VoteStoreBackend, params.RecordFilePath)
+	if err != nil {
+		return cli.Exit(fmt.Sprint("Error opening vote store: ", err), exitFailure)
+	}
+	defer func() {
+		if err := voteStore.Close(); err != nil {
+			storeLog.Error("Failed to close vote store", "err", err)
+		}
+	}()
+	validatorSet, _ := abi.NewValidatorsetCaller(utils.ValidatorSetAddr, clients)
+	validators := utils.NewValidatorSet(validatorSet)
+	if err := validators.Refresh(); err != nil {
+		return cli.Exit(fmt.Sprint("Error loading validator set: ", err), exitNetwork)
+	}
+	goBackground(func() { validatorSetLoop(ctx.Context, clients, validators) })
+	goBackground(func() { relayerLoop(ctx.Context, clients) })
 
-	registerRelayer(client)
+	queue, err := utils.NewEvidenceQueue(path.Join(params.RecordFilePath, "evidence"))
+	if err != nil {
+		return cli.Exit(fmt.Sprint("Error opening evidence queue: ", err), exitFailure)
+	}
+	submitter := utils.NewSubmitter(clients, queue, utils.NewTxSender(clients, utils.SlashAccount.Signer, utils.ChainId))
+	submitter.Notifier = notifier
+	goBackground(func() { submitter.Run(ctx.Context) })
 
-	var vrStore = utils.NewVotesRecordStore(params.RecordFilePath)
-	voteMonitorLoop(client, vrStore)
+	backfilledVoteChannel := make(chan *utils.BackfilledVote)
+	backfiller, err := utils.NewBackfiller(clients, path.Join(params.RecordFilePath, "backfill"), backfilledVoteChannel)
+	if err != nil {
+		return cli.Exit(fmt.Sprint("Error opening backfill cursor: ", err), exitFailure)
+	}
+	goBackground(func() { backfiller.Run(ctx.Context) })
 
-	//finalizedHeaderMonitorLoop(client)
+	goBackground(func() { finalizedLoop(ctx.Context, clients, voteStore, submitter, backfiller) })
+	voteMonitorLoop(ctx.Context, clients, voteStore, validators, queue, backfilledVoteChannel)
+	log.Info("Shutting down, waiting for evidence in flight")
+	background.Wait()
+	log.Info("Stopped")
+	return nil
+}
 
-	//callContract(client)
+func main() {
+	// the root context is cancelled on SIGINT and SIGTERM; a second signal
+	// kills the process right away
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	if err := newApp().RunContext(ctx, os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitFailure)
+	}
 }
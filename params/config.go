@@ -3,15 +3,98 @@ package params
 import "time"
 
 var (
-	BSCTestnet = "https://data-seed-prebsc-2-s1.binance.org:8545/"
-	BSC        = "https://bsc-dataseed.binance.org/"
+	BSCTestnet = "wss://bsc-testnet-rpc.publicnode.com"
+	BSC        = "wss://bsc-rpc.publicnode.com"
 	GethWS     = "ws://127.0.0.1:8547"
 	GethIpc    = "/server/validator/geth.ipc"
 
-	Address    = "0x91D7deA99716Cbb247E81F1cfB692009164a967E"
-	PrivateKey = "dcb154cd2e8e0d5deffbc43562933e02ac3415225f5147cbcd37b380191fbe49"
+	// set from the Config by Apply, the defaults are the local profile
+	Address               = ""
+	Network               = DefaultNetwork
+	Endpoints             = []string{GethWS}
+	ChainID               = uint64(714)
+	SlashIndicatorAddress = "0x0000000000000000000000000000000000001001"
+	ValidatorSetAddress   = "0x0000000000000000000000000000000000001000"
+	RelayerHubAddress     = "0x0000000000000000000000000000000000001006"
+	TokenHubAddress       = "0x0000000000000000000000000000000000001004"
 
-	RecordFilePath = "./data/"
+	VoteStoreBackend   = "memory"
+	RecordFilePath     = "./data/"
+	CheckpointInterval = time.Duration(300 * 1e9)
+
+	// SlashIndicator rejects evidence once a vote target is this many blocks old
+	EvidenceWindow = uint64(256)
+	// votes are kept this many blocks behind the finalized head, by default
+	// just the evidence window, as older votes cannot be reported any more
+	PruneSafetyMargin = EvidenceWindow
+
+	SubmitPollInterval = time.Duration(3 * 1e9)
+	SubmitBackoffMin   = time.Duration(3 * 1e9)
+	SubmitBackoffMax   = time.Duration(300 * 1e9)
+	// on shutdown, the receipts of evidence in flight are awaited this long
+	ShutdownTimeout = time.Duration(30 * 1e9)
+	// at most this many evidence transactions are in flight at once
+	MaxInflightEvidence = 16
+	// a stuck evidence transaction is replaced at most this many times
+	MaxSpeedUps = 5
+	// the transaction pool only accepts a replacement paying at least 10% more,
+	// bumping by a bit more leaves room for rounding
+	ReplacementBumpPercent = uint64(12)
+	TxGas                  = uint64(21000)
+	// an evidence transaction not mined after this many blocks gets a higher
+	// gas price, so it lands before a competing reporter's
+	FeeBumpBlocks = uint64(3)
+
+	GasLimitMultiplier = 1.3
+	MinGasLimit        = uint64(300000)
+	MaxGasLimit        = uint64(3000000)
+	GasPriceMultiplier = 1.1
+	MinGasPriceGwei    = uint64(5)
+	MaxGasPriceGwei    = uint64(100)
+
+	// a subscription without notifications for this long is considered dead
+	// and opened again
+	SubscriptionStallTimeout = time.Duration(60 * 1e9)
+	ResubscribeBackoffMin    = time.Duration(1 * 1e9)
+	ResubscribeBackoffMax    = time.Duration(60 * 1e9)
+
+	// votes are recovered from the attestations of at most this many finalized
+	// blocks behind the head, older ones are outside the evidence window
+	BackfillMaxBlocks = uint64(256)
+	// the backfill position is saved every this many blocks
+	BackfillCursorInterval = uint64(20)
+
+	// an endpoint whose head is older than this is failed over from
+	MaxHeadAge            = time.Duration(30 * 1e9)
+	EndpointCheckInterval = time.Duration(15 * 1e9)
+	// number of recent votes remembered to drop the copies received from
+	// other endpoints
+	VoteDedupSize = 4096
+	// at most this many invalid votes are logged per minute
+	InvalidVoteLogRate = uint64(10)
 
 	UpdateInterval = time.Duration(60 * 1e9)
+	// address of the /metrics, /healthz and /readyz endpoints of the monitor,
+	// empty disables them
+	MetricsAddr = "127.0.0.1:6060"
+	// the relayer balance and registration are checked this often
+	RelayerCheckInterval = time.Duration(60 * 1e9)
+	// the monitor is not ready after this long without a vote, or without the
+	// finalized head advancing
+	ReadyVoteTimeout      = time.Duration(60 * 1e9)
+	ReadyFinalizedTimeout = time.Duration(60 * 1e9)
+	// the monitor is not ready while the relayer holds less than this
+	GasReserveGwei = uint64(1e8)
+	// a subscription down for this long is alerted as a monitoring gap
+	NotifyGapThreshold = time.Duration(30 * 1e9)
+	// webhooks notified of violations, evidence and monitoring gaps
+	Webhooks []Webhook
+	// notifications of a severity sent to a webhook per minute, unless it sets
+	// its own limit
+	NotifyRateLimit = uint64(10)
+	// a notification is posted this many times before it is dropped
+	NotifyAttempts = 3
+	NotifyTimeout  = time.Duration(10 * 1e9)
+	// blocks per epoch of parlia, the validator set may change at each boundary
+	EpochLength = uint64(200)
 )
@@ -0,0 +1,376 @@
+package params
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"gopkg.in/yaml.v2"
+)
+
+const envPrefix = "SLASH_ROBOT"
+
+// LoadConfig builds the configuration from the profile of network, the file
+// at path and the environment. Empty network and path are skipped; the network
+// is otherwise taken from SLASH_ROBOT_NETWORK, the file, or DefaultNetwork, in
+// that order. The caller validates the result once flags are applied.
+func LoadConfig(path, network string) (*Config, error) {
+	return loadConfig(path, network, os.LookupEnv)
+}
+
+func loadConfig(path, network string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	var file []byte
+	if path != "" {
+		var err error
+		if file, err = ioutil.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if network == "" {
+		network, _ = lookupEnv(envPrefix + "_NETWORK")
+	}
+	if network == "" && file != nil {
+		var peek struct {
+			Network string `yaml:"network"`
+		}
+		if err := yaml.Unmarshal(file, &peek); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		network = peek.Network
+	}
+	if network == "" {
+		network = DefaultNetwork
+	}
+	profile, ok := Profiles[network]
+	if !ok {
+		return nil, fmt.Errorf("unknown network %q", network)
+	}
+
+	cfg := defaultConfig()
+	cfg.Network = network
+	cfg.Endpoints = append([]string{}, profile.Endpoints...)
+	cfg.ChainID = profile.ChainID
+	cfg.Contracts = profile.Contracts
+	cfg.Relayer = profile.Relayer
+	if file != nil {
+		if err := yaml.UnmarshalStrict(file, cfg); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if cfg.Network != network {
+			return nil, fmt.Errorf("%s: network %q does not match %q", path, cfg.Network, network)
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(cfg).Elem(), envPrefix, lookupEnv); err != nil {
+		return nil, err
+	}
+	cfg.Network = network
+	return cfg, nil
+}
+
+// defaultConfig returns the settings that do not depend on the network.
+func defaultConfig() *Config {
+	return &Config{
+		DataDir:                  RecordFilePath,
+		VoteStore:                VoteStoreBackend,
+		CheckpointInterval:       CheckpointInterval,
+		EvidenceWindow:           EvidenceWindow,
+		UpdateInterval:           UpdateInterval,
+		SubscriptionStallTimeout: SubscriptionStallTimeout,
+		MetricsAddr:              MetricsAddr,
+		Health: Health{
+			VoteTimeout:      ReadyVoteTimeout,
+			FinalizedTimeout: ReadyFinalizedTimeout,
+		},
+		Notify: Notify{
+			GapThreshold: NotifyGapThreshold,
+		},
+		Gas: Gas{
+			LimitMultiplier: GasLimitMultiplier,
+			MinLimit:        MinGasLimit,
+			MaxLimit:        MaxGasLimit,
+			PriceMultiplier: GasPriceMultiplier,
+			MinPriceGwei:    MinGasPriceGwei,
+			MaxPriceGwei:    MaxGasPriceGwei,
+			ReserveGwei:     GasReserveGwei,
+		},
+		Submitter: Submitter{
+			MaxInflight:   uint64(MaxInflightEvidence),
+			MaxSpeedUps:   uint64(MaxSpeedUps),
+			FeeBumpBlocks: FeeBumpBlocks,
+		},
+	}
+}
+
+// applyEnv overrides the fields of v with the environment variables named
+// after their YAML keys, or their env tag for fields kept out of the file.
+func applyEnv(v reflect.Value, prefix string, lookupEnv func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key, ok := t.Field(i).Tag.Lookup("env")
+		if !ok {
+			key = strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		}
+		name := prefix + "_" + strings.ToUpper(key)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field, name, lookupEnv); err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok := lookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", field.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	case reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// Validate checks that the configuration is usable. A missing relayer address
+// is derived from the private key.
+func (c *Config) Validate() error {
+	if err := c.ValidateChain(); err != nil {
+		return err
+	}
+	if c.Relayer.PrivateKey != "" && c.Network != "local" {
+		return fmt.Errorf("relayer.private_key is only accepted on the local network, use relayer.keystore or relayer.signer on %s", c.Network)
+	}
+	keyAddr, err := c.Relayer.keyAddress()
+	if err != nil {
+		return err
+	}
+	if c.Relayer.Address == "" {
+		c.Relayer.Address = keyAddr.Hex()
+	} else if !common.IsHexAddress(c.Relayer.Address) || common.HexToAddress(c.Relayer.Address) != keyAddr {
+		return fmt.Errorf("relayer.address %s does not belong to the private key, which is %s", c.Relayer.Address, keyAddr.Hex())
+	}
+	return nil
+}
+
+// ValidateSubscriptions checks that every endpoint can serve the subscriptions
+// the monitor follows votes and heads with, which plain HTTP cannot.
+func ValidateSubscriptions(endpoints []string) error {
+	for _, endpoint := range endpoints {
+		if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+			return fmt.Errorf("endpoint %s cannot subscribe, use a ws://, wss:// or IPC endpoint", endpoint)
+		}
+	}
+	return nil
+}
+
+// ValidateChain checks everything but the relayer, which commands only
+// reading the chain do not need.
+func (c *Config) ValidateChain() error {
+	if len(c.Endpoints) == 0 {
+		return errors.New("no endpoints")
+	}
+	if c.ChainID == 0 {
+		return errors.New("chain_id missing")
+	}
+	for name, addr := range map[string]string{
+		"slash_indicator": c.Contracts.SlashIndicator,
+		"validator_set":   c.Contracts.ValidatorSet,
+		"relayer_hub":     c.Contracts.RelayerHub,
+		"token_hub":       c.Contracts.TokenHub,
+	} {
+		if !common.IsHexAddress(addr) {
+			return fmt.Errorf("contracts.%s: invalid address %q", name, addr)
+		}
+	}
+	if c.DataDir == "" {
+		return errors.New("data_dir missing")
+	}
+	if c.VoteStore != "memory" && c.VoteStore != "leveldb" {
+		return fmt.Errorf("vote_store: unknown backend %q", c.VoteStore)
+	}
+	if c.CheckpointInterval <= 0 {
+		return errors.New("checkpoint_interval must be positive")
+	}
+	if c.EvidenceWindow == 0 {
+		return errors.New("evidence_window must be positive")
+	}
+	if c.PruneSafetyMargin != 0 && c.PruneSafetyMargin < c.EvidenceWindow {
+		return fmt.Errorf("prune_safety_margin %d below the evidence window of %d blocks", c.PruneSafetyMargin, c.EvidenceWindow)
+	}
+	if c.UpdateInterval <= 0 {
+		return errors.New("update_interval must be positive")
+	}
+	if c.SubscriptionStallTimeout <= 0 {
+		return errors.New("subscription_stall_timeout must be positive")
+	}
+	if c.Health.VoteTimeout <= 0 || c.Health.FinalizedTimeout <= 0 {
+		return errors.New("health timeouts must be positive")
+	}
+	if err := c.Notify.validate(); err != nil {
+		return err
+	}
+	if c.Gas.LimitMultiplier < 1 || c.Gas.PriceMultiplier < 1 {
+		return errors.New("gas multipliers must be at least 1")
+	}
+	if c.Gas.MinLimit > c.Gas.MaxLimit {
+		return errors.New("gas.min_limit above gas.max_limit")
+	}
+	if c.Gas.MinPriceGwei > c.Gas.MaxPriceGwei {
+		return errors.New("gas.min_price_gwei above gas.max_price_gwei")
+	}
+	if c.Submitter.MaxInflight == 0 {
+		return errors.New("submitter.max_inflight must be positive")
+	}
+	if c.Submitter.FeeBumpBlocks == 0 {
+		return errors.New("submitter.fee_bump_blocks must be positive")
+	}
+	return nil
+}
+
+func (n *Notify) validate() error {
+	if n.GapThreshold <= 0 {
+		return errors.New("notify.gap_threshold must be positive")
+	}
+	for i, hook := range n.Webhooks {
+		name := hook.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("notify.webhooks %s: invalid url %q", name, hook.URL)
+		}
+		switch hook.Format {
+		case "", "slack", "json":
+		case "pagerduty":
+			if hook.RoutingKey == "" {
+				return fmt.Errorf("notify.webhooks %s: routing_key missing", name)
+			}
+		default:
+			return fmt.Errorf("notify.webhooks %s: unknown format %q", name, hook.Format)
+		}
+		for _, severity := range hook.Severities {
+			if severity != "info" && severity != "warning" && severity != "critical" {
+				return fmt.Errorf("notify.webhooks %s: unknown severity %q", name, severity)
+			}
+		}
+	}
+	return nil
+}
+
+// keyAddress returns the address of the relayer key without decrypting it.
+func (r *Relayer) keyAddress() (common.Address, error) {
+	switch {
+	case r.Signer != "":
+		if !common.IsHexAddress(r.Address) {
+			return common.Address{}, errors.New("relayer.address missing, it is required with relayer.signer")
+		}
+		return common.HexToAddress(r.Address), nil
+	case r.Keystore != "":
+		data, err := ioutil.ReadFile(r.Keystore)
+		if err != nil {
+			return common.Address{}, fmt.Errorf("relayer.keystore: %v", err)
+		}
+		var keyJSON struct {
+			Address string `json:"address"`
+		}
+		if err := json.Unmarshal(data, &keyJSON); err != nil || !common.IsHexAddress(keyJSON.Address) {
+			return common.Address{}, fmt.Errorf("relayer.keystore: %s is not a keystore file", r.Keystore)
+		}
+		if r.PasswordFile == "" && r.Password == "" {
+			return common.Address{}, errors.New("relayer.password_file missing")
+		}
+		return common.HexToAddress(keyJSON.Address), nil
+	case r.PrivateKey != "":
+		key, err := crypto.HexToECDSA(strings.TrimPrefix(r.PrivateKey, "0x"))
+		if err != nil {
+			return common.Address{}, fmt.Errorf("relayer.private_key: %v", err)
+		}
+		return crypto.PubkeyToAddress(key.PublicKey), nil
+	}
+	return common.Address{}, errors.New("relayer.keystore missing")
+}
+
+// Apply makes the configuration the values of the package variables.
+func (c *Config) Apply() {
+	Network = c.Network
+	Endpoints = c.Endpoints
+	ChainID = c.ChainID
+	SlashIndicatorAddress = c.Contracts.SlashIndicator
+	ValidatorSetAddress = c.Contracts.ValidatorSet
+	RelayerHubAddress = c.Contracts.RelayerHub
+	TokenHubAddress = c.Contracts.TokenHub
+	Address = c.Relayer.Address
+	RecordFilePath = c.DataDir
+	VoteStoreBackend = c.VoteStore
+	CheckpointInterval = c.CheckpointInterval
+	EvidenceWindow = c.EvidenceWindow
+	PruneSafetyMargin = c.PruneSafetyMargin
+	if PruneSafetyMargin == 0 {
+		PruneSafetyMargin = EvidenceWindow
+	}
+	UpdateInterval = c.UpdateInterval
+	SubscriptionStallTimeout = c.SubscriptionStallTimeout
+	MetricsAddr = c.MetricsAddr
+	ReadyVoteTimeout = c.Health.VoteTimeout
+	ReadyFinalizedTimeout = c.Health.FinalizedTimeout
+	GasReserveGwei = c.Gas.ReserveGwei
+	NotifyGapThreshold = c.Notify.GapThreshold
+	Webhooks = c.Notify.Webhooks
+	GasLimitMultiplier = c.Gas.LimitMultiplier
+	MinGasLimit = c.Gas.MinLimit
+	MaxGasLimit = c.Gas.MaxLimit
+	GasPriceMultiplier = c.Gas.PriceMultiplier
+	MinGasPriceGwei = c.Gas.MinPriceGwei
+	MaxGasPriceGwei = c.Gas.MaxPriceGwei
+	MaxInflightEvidence = int(c.Submitter.MaxInflight)
+	MaxSpeedUps = int(c.Submitter.MaxSpeedUps)
+	FeeBumpBlocks = c.Submitter.FeeBumpBlocks
+}
@@ -0,0 +1,295 @@
+package params
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// testKey is a relayer key made for the test run, testAddress its address.
+var testKey, testAddress = generateTestKey()
+
+func generateTestKey() (string, string) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(crypto.FromECDSA(key)), crypto.PubkeyToAddress(key.PublicKey).Hex()
+}
+
+func writeTestConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// loadValidConfig loads the configuration and validates it, as the commands
+// using the relayer do.
+func loadValidConfig(path, network string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg, err := loadConfig(path, network, lookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, cfg.Validate()
+}
+
+func testEnv(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+// writeTestKeystore writes a keystore file of testAddress, which is enough
+// for validation.
+func writeTestKeystore(t *testing.T) string {
+	return writeTestConfig(t, `{"address":"`+testAddress[2:]+`","crypto":{}}`)
+}
+
+func TestLoadConfigLayers(t *testing.T) {
+	path := writeTestConfig(t, `
+network: testnet
+endpoints: [ws://a, ws://b]
+relayer:
+  keystore: `+writeTestKeystore(t)+`
+update_interval: 30s
+gas:
+  max_price_gwei: 50
+`)
+	cfg, err := loadValidConfig(path, "", testEnv(map[string]string{
+		"SLASH_ROBOT_GAS_MAX_PRICE_GWEI": "20",
+		"SLASH_ROBOT_DATA_DIR":           "/var/lib/robot",
+		"SLASH_ROBOT_RELAYER_PASSWORD":   "secret",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// profile
+	if cfg.ChainID != 97 || cfg.Contracts.SlashIndicator != systemContracts.SlashIndicator {
+		t.Error("profile not applied", cfg.ChainID)
+	}
+	// file
+	if strings.Join(cfg.Endpoints, ",") != "ws://a,ws://b" || cfg.UpdateInterval != 30*time.Second {
+		t.Error("file not applied", cfg.Endpoints, cfg.UpdateInterval)
+	}
+	// environment
+	if cfg.Gas.MaxPriceGwei != 20 || cfg.DataDir != "/var/lib/robot" {
+		t.Error("environment not applied", cfg.Gas.MaxPriceGwei, cfg.DataDir)
+	}
+	// defaults and derived values
+	if cfg.Gas.MinPriceGwei != MinGasPriceGwei || cfg.Relayer.Address != testAddress || cfg.Relayer.Password != "secret" {
+		t.Error("defaults not kept", cfg.Gas.MinPriceGwei, cfg.Relayer.Address)
+	}
+}
+
+func TestConfigRelayerSecrets(t *testing.T) {
+	path := writeTestConfig(t, "network: local\nrelayer:\n  password: secret\n")
+	if _, err := loadConfig(path, "", testEnv(nil)); err == nil {
+		t.Error("password accepted in the configuration file")
+	}
+	path = writeTestConfig(t, "network: local\nrelayer:\n  private_key: "+testKey+"\n")
+	if _, err := loadValidConfig(path, "", testEnv(nil)); err != nil {
+		t.Error("private key refused on the local network:", err)
+	}
+	for _, network := range []string{"testnet", "mainnet"} {
+		_, err := loadValidConfig("", network, testEnv(withKey(nil)))
+		if err == nil || !strings.Contains(err.Error(), "only accepted on the local network") {
+			t.Errorf("private key on %s: error %v", network, err)
+		}
+	}
+}
+
+// withKey adds the relayer key to env, which no profile configures.
+func withKey(env map[string]string) map[string]string {
+	withKey := map[string]string{"SLASH_ROBOT_RELAYER_PRIVATE_KEY": testKey}
+	for name, value := range env {
+		withKey[name] = value
+	}
+	return withKey
+}
+
+func TestLoadConfigNetwork(t *testing.T) {
+	cfg, err := loadValidConfig("", "", testEnv(withKey(nil)))
+	if err != nil || cfg.Network != DefaultNetwork {
+		t.Fatal("default network", err)
+	}
+	cfg, err = loadConfig("", "mainnet", testEnv(map[string]string{"SLASH_ROBOT_NETWORK": "testnet"}))
+	if err != nil || cfg.ChainID != 56 {
+		t.Fatal("network flag does not win over environment", err)
+	}
+	if _, err := loadValidConfig("", "devnet", testEnv(withKey(nil))); err == nil {
+		t.Fatal("unknown network accepted")
+	}
+	path := writeTestConfig(t, "network: testnet\n")
+	if _, err := loadValidConfig(path, "mainnet", testEnv(withKey(nil))); err == nil {
+		t.Fatal("file of another network accepted")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	keystore := writeTestKeystore(t)
+	tests := []struct {
+		env map[string]string
+		err string
+	}{
+		{map[string]string{"SLASH_ROBOT_RELAYER_PRIVATE_KEY": ""}, "relayer.keystore missing"},
+		{map[string]string{"SLASH_ROBOT_RELAYER_KEYSTORE": keystore}, "password_file missing"},
+		{map[string]string{"SLASH_ROBOT_RELAYER_KEYSTORE": "/nonexistent"}, "relayer.keystore"},
+		{map[string]string{"SLASH_ROBOT_RELAYER_SIGNER": "http://localhost:8550"}, "relayer.address missing"},
+		{map[string]string{"SLASH_ROBOT_RELAYER_ADDRESS": "0x0000000000000000000000000000000000000001"}, "does not belong"},
+		{map[string]string{"SLASH_ROBOT_ENDPOINTS": ""}, "no endpoints"},
+		{map[string]string{"SLASH_ROBOT_VOTE_STORE": "redis"}, "unknown backend"},
+		{map[string]string{"SLASH_ROBOT_GAS_MIN_LIMIT": "9000000"}, "min_limit"},
+		{map[string]string{"SLASH_ROBOT_CONTRACTS_SLASH_INDICATOR": "0x1"}, "invalid address"},
+		{map[string]string{"SLASH_ROBOT_UPDATE_INTERVAL": "soon"}, "invalid duration"},
+		{map[string]string{"SLASH_ROBOT_HEALTH_VOTE_TIMEOUT": "0s"}, "health timeouts"},
+		{map[string]string{"SLASH_ROBOT_PRUNE_SAFETY_MARGIN": "100"}, "below the evidence window"},
+		{map[string]string{"SLASH_ROBOT_SUBMITTER_FEE_BUMP_BLOCKS": "0"}, "fee_bump_blocks"},
+		{map[string]string{"SLASH_ROBOT_SUBMITTER_MAX_INFLIGHT": "0"}, "max_inflight"},
+		{map[string]string{"SLASH_ROBOT_CHECKPOINT_INTERVAL": "0s"}, "checkpoint_interval"},
+		{map[string]string{"SLASH_ROBOT_SUBSCRIPTION_STALL_TIMEOUT": "0s"}, "subscription_stall_timeout"},
+		{map[string]string{"SLASH_ROBOT_EVIDENCE_WINDOW": "0"}, "evidence_window"},
+		{map[string]string{"SLASH_ROBOT_EVIDENCE_WINDOW": "512", "SLASH_ROBOT_PRUNE_SAFETY_MARGIN": "300"}, "below the evidence window of 512"},
+	}
+	for _, test := range tests {
+		_, err := loadValidConfig("", "local", testEnv(withKey(test.env)))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%v: error %v, want %q", test.env, err, test.err)
+		}
+	}
+	path := writeTestConfig(t, "chain_idd: 1\n")
+	if _, err := loadValidConfig(path, "", testEnv(withKey(nil))); err == nil {
+		t.Error("unknown key accepted")
+	}
+}
+
+func TestConfigKeystore(t *testing.T) {
+	keystore := writeTestKeystore(t)
+	cfg, err := loadValidConfig("", "local", testEnv(map[string]string{
+		"SLASH_ROBOT_RELAYER_KEYSTORE": keystore,
+		"SLASH_ROBOT_RELAYER_PASSWORD": "secret",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Relayer.Address != testAddress {
+		t.Error("address not taken from the keystore", cfg.Relayer.Address)
+	}
+}
+
+func TestConfigValidateChain(t *testing.T) {
+	cfg, err := loadConfig("", "testnet", testEnv(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.ValidateChain(); err != nil {
+		t.Error("relayer required to read the chain:", err)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("missing relayer accepted")
+	}
+}
+
+func TestValidateSubscriptions(t *testing.T) {
+	for _, network := range []string{"local", "testnet", "mainnet"} {
+		if err := ValidateSubscriptions(Profiles[network].Endpoints); err != nil {
+			t.Errorf("%s: %v", network, err)
+		}
+	}
+	if err := ValidateSubscriptions([]string{GethWS, "https://bsc-dataseed.binance.org/"}); err == nil {
+		t.Error("http endpoint accepted")
+	}
+}
+
+func TestConfigNotify(t *testing.T) {
+	tests := []struct {
+		webhooks string
+		err      string
+	}{
+		{`[{name: ops, url: "https://hooks.example/x", severities: [critical, warning], rate_limit: 5}]`, ""},
+		{`[{url: "https://events.example/v2/enqueue", format: pagerduty, routing_key: abc}]`, ""},
+		{`[{name: ops, url: "hooks.example"}]`, "invalid url"},
+		{`[{url: "https://hooks.example", format: teams}]`, "unknown format"},
+		{`[{url: "https://events.example", format: pagerduty}]`, "routing_key missing"},
+		{`[{url: "https://hooks.example", severities: [page]}]`, "unknown severity"},
+	}
+	for _, test := range tests {
+		path := writeTestConfig(t, "network: local\nnotify:\n  webhooks: "+test.webhooks+"\n")
+		cfg, err := loadConfig(path, "", testEnv(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = cfg.ValidateChain()
+		if test.err == "" {
+			if err != nil {
+				t.Error(test.webhooks, err)
+			} else if cfg.Notify.GapThreshold != NotifyGapThreshold {
+				t.Error("gap threshold default not kept", cfg.Notify.GapThreshold)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got %v, want %q", test.webhooks, err, test.err)
+		}
+	}
+
+	if _, err := loadConfig("", "local", testEnv(map[string]string{"SLASH_ROBOT_NOTIFY_WEBHOOKS": "https://hooks.example"})); err == nil {
+		t.Error("webhooks set from the environment")
+	}
+}
+
+func TestConfigPruneSafetyMargin(t *testing.T) {
+	defer func(margin uint64) { PruneSafetyMargin = margin }(PruneSafetyMargin)
+	for margin, want := range map[string]uint64{"": EvidenceWindow, "0": EvidenceWindow, "300": 300} {
+		env := map[string]string{}
+		if margin != "" {
+			env["SLASH_ROBOT_PRUNE_SAFETY_MARGIN"] = margin
+		}
+		cfg, err := loadValidConfig("", "local", testEnv(withKey(env)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.Apply()
+		if PruneSafetyMargin != want {
+			t.Errorf("prune_safety_margin %q applied as %d, want %d", margin, PruneSafetyMargin, want)
+		}
+	}
+}
+
+func TestConfigSubmitterTuning(t *testing.T) {
+	defer func(window, margin uint64, checkpoint, stall time.Duration, inflight, speedUps int, bump uint64) {
+		EvidenceWindow, PruneSafetyMargin, CheckpointInterval, SubscriptionStallTimeout = window, margin, checkpoint, stall
+		MaxInflightEvidence, MaxSpeedUps, FeeBumpBlocks = inflight, speedUps, bump
+	}(EvidenceWindow, PruneSafetyMargin, CheckpointInterval, SubscriptionStallTimeout, MaxInflightEvidence, MaxSpeedUps, FeeBumpBlocks)
+
+	path := writeTestConfig(t, `
+network: local
+checkpoint_interval: 1m
+evidence_window: 512
+subscription_stall_timeout: 2m
+submitter:
+  max_inflight: 4
+  max_speed_ups: 0
+  fee_bump_blocks: 5
+`)
+	cfg, err := loadValidConfig(path, "", testEnv(withKey(map[string]string{"SLASH_ROBOT_SUBMITTER_MAX_INFLIGHT": "8"})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Apply()
+	if CheckpointInterval != time.Minute || SubscriptionStallTimeout != 2*time.Minute {
+		t.Error("durations not applied", CheckpointInterval, SubscriptionStallTimeout)
+	}
+	// the prune margin follows the evidence window
+	if EvidenceWindow != 512 || PruneSafetyMargin != 512 {
+		t.Error("evidence window not applied", EvidenceWindow, PruneSafetyMargin)
+	}
+	if MaxInflightEvidence != 8 || MaxSpeedUps != 0 || FeeBumpBlocks != 5 {
+		t.Error("submitter settings not applied", MaxInflightEvidence, MaxSpeedUps, FeeBumpBlocks)
+	}
+}
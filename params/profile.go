@@ -0,0 +1,146 @@
+package params
+
+import (
+	"time"
+)
+
+// Config is the configuration of the robot. It is layered: the network
+// profile provides the defaults, a YAML file overrides them, and environment
+// variables named SLASH_ROBOT_<KEY> override the file, where KEY is the
+// upper cased YAML path joined by underscores, e.g. SLASH_ROBOT_RELAYER_PASSWORD.
+type Config struct {
+	Network   string    `yaml:"network"`
+	Endpoints []string  `yaml:"endpoints"`
+	ChainID   uint64    `yaml:"chain_id"`
+	Contracts Contracts `yaml:"contracts"`
+	Relayer   Relayer   `yaml:"relayer"`
+
+	DataDir   string `yaml:"data_dir"`
+	VoteStore string `yaml:"vote_store"`
+	// CheckpointInterval is how often the logs of the memory vote store are
+	// compacted.
+	CheckpointInterval time.Duration `yaml:"checkpoint_interval"`
+	// EvidenceWindow is how many blocks old a vote target SlashIndicator still
+	// accepts evidence for.
+	EvidenceWindow uint64 `yaml:"evidence_window"`
+	// PruneSafetyMargin is how many blocks of votes are kept behind the
+	// finalized head; 0 keeps the evidence window.
+	PruneSafetyMargin uint64        `yaml:"prune_safety_margin"`
+	UpdateInterval    time.Duration `yaml:"update_interval"`
+	// SubscriptionStallTimeout is how long a subscription may go without
+	// notifications before it is opened again.
+	SubscriptionStallTimeout time.Duration `yaml:"subscription_stall_timeout"`
+	Gas                      Gas           `yaml:"gas"`
+	Submitter                Submitter     `yaml:"submitter"`
+	MetricsAddr              string        `yaml:"metrics_addr"`
+	Health                   Health        `yaml:"health"`
+	Notify                   Notify        `yaml:"notify"`
+}
+
+type Contracts struct {
+	SlashIndicator string `yaml:"slash_indicator"`
+	ValidatorSet   string `yaml:"validator_set"`
+	RelayerHub     string `yaml:"relayer_hub"`
+	TokenHub       string `yaml:"token_hub"`
+}
+
+// Relayer is the account reporting evidence. Its transactions are signed by an
+// external signer, or with a key read from an encrypted go-ethereum keystore
+// file; the passphrase is read from a password file or from
+// SLASH_ROBOT_RELAYER_PASSWORD, never from the configuration file.
+type Relayer struct {
+	Address string `yaml:"address"`
+	// Signer is the IPC path or HTTP URL of a Clef compatible signer holding
+	// the key, which then never enters the robot. Address must be set with it.
+	Signer       string `yaml:"signer"`
+	Keystore     string `yaml:"keystore"`
+	PasswordFile string `yaml:"password_file"`
+	Password     string `yaml:"-" env:"password"`
+	// PrivateKey is a plaintext hex key, only accepted on the local devnet
+	PrivateKey string `yaml:"private_key"`
+}
+
+type Gas struct {
+	LimitMultiplier float64 `yaml:"limit_multiplier"`
+	MinLimit        uint64  `yaml:"min_limit"`
+	MaxLimit        uint64  `yaml:"max_limit"`
+	PriceMultiplier float64 `yaml:"price_multiplier"`
+	MinPriceGwei    uint64  `yaml:"min_price_gwei"`
+	MaxPriceGwei    uint64  `yaml:"max_price_gwei"`
+	// ReserveGwei is the relayer balance below which the robot is not ready
+	ReserveGwei uint64 `yaml:"reserve_gwei"`
+}
+
+// Submitter sets how evidence transactions are followed until mined.
+type Submitter struct {
+	// MaxInflight is the most evidence transactions in flight at once.
+	MaxInflight uint64 `yaml:"max_inflight"`
+	// MaxSpeedUps is how many times a stuck transaction is replaced at most.
+	MaxSpeedUps uint64 `yaml:"max_speed_ups"`
+	// FeeBumpBlocks is how many blocks a transaction may stay unmined before
+	// it is replaced by one paying more.
+	FeeBumpBlocks uint64 `yaml:"fee_bump_blocks"`
+}
+
+// Health sets when /readyz reports the robot as not ready.
+type Health struct {
+	VoteTimeout      time.Duration `yaml:"vote_timeout"`
+	FinalizedTimeout time.Duration `yaml:"finalized_timeout"`
+}
+
+// Notify routes alerts about violations, evidence and monitoring gaps to
+// webhooks.
+type Notify struct {
+	// GapThreshold is how long a subscription may be down before it is
+	// alerted as a monitoring gap.
+	GapThreshold time.Duration `yaml:"gap_threshold"`
+	Webhooks     []Webhook     `yaml:"webhooks"`
+}
+
+// Webhook receives the alerts of the severities it is routed.
+type Webhook struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// Format is slack for Slack compatible messages, pagerduty for PagerDuty
+	// Events API v2 events, or json for the plain notification.
+	Format string `yaml:"format"`
+	// RoutingKey is the integration key of a pagerduty webhook.
+	RoutingKey string `yaml:"routing_key"`
+	// Severities are the severities sent, all of them if empty: info, warning
+	// or critical.
+	Severities []string `yaml:"severities"`
+	// Template is a text/template of the message, see utils.Notification.
+	Template string `yaml:"template"`
+	// RateLimit is the most notifications of a severity sent per minute, the
+	// default if 0. Resolves are not limited.
+	RateLimit uint64 `yaml:"rate_limit"`
+}
+
+var systemContracts = Contracts{
+	SlashIndicator: "0x0000000000000000000000000000000000001001",
+	ValidatorSet:   "0x0000000000000000000000000000000000001000",
+	RelayerHub:     "0x0000000000000000000000000000000000001006",
+	TokenHub:       "0x0000000000000000000000000000000000001004",
+}
+
+// Profiles are the networks the robot knows. Local is a devnet started from
+// the bsc genesis tooling.
+var Profiles = map[string]Config{
+	"local": {
+		Endpoints: []string{GethWS},
+		ChainID:   714,
+		Contracts: systemContracts,
+	},
+	"testnet": {
+		Endpoints: []string{BSCTestnet},
+		ChainID:   97,
+		Contracts: systemContracts,
+	},
+	"mainnet": {
+		Endpoints: []string{BSC},
+		ChainID:   56,
+		Contracts: systemContracts,
+	},
+}
+
+const DefaultNetwork = "local"
@@ -2,18 +2,82 @@ package utils
 
 import (
 	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"slash-robot/params"
+	"strings"
 
+	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
-var SlashAccount = ExtAcc{
-	RawKey: params.PrivateKey,
-	Addr:   common.HexToAddress(params.Address),
-}
+// SlashAccount is the account reporting evidence and relaying. Its signer is
+// set by UseSigner.
+var SlashAccount ExtAcc
 
 type ExtAcc struct {
-	RawKey string
-	Key    *ecdsa.PrivateKey
+	Signer Signer
 	Addr   common.Address
 }
+
+// UseSigner makes signer the signer of SlashAccount.
+func UseSigner(signer Signer) {
+	SlashAccount = ExtAcc{Signer: signer, Addr: signer.Address()}
+}
+
+// NewRelayerSigner returns the external signer of relayer if one is
+// configured, and a signer with its decrypted key otherwise.
+func NewRelayerSigner(relayer params.Relayer) (Signer, error) {
+	if relayer.Signer != "" {
+		return NewExternalSigner(relayer.Signer, common.HexToAddress(relayer.Address))
+	}
+	key, err := LoadRelayerKey(relayer)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySigner(key), nil
+}
+
+// LoadRelayerKey decrypts the keystore file of relayer, or decodes its
+// plaintext private key if no keystore is configured.
+func LoadRelayerKey(relayer params.Relayer) (*ecdsa.PrivateKey, error) {
+	if relayer.Keystore == "" {
+		if relayer.PrivateKey == "" {
+			return nil, errors.New("no relayer key configured")
+		}
+		relayerLog.Warn("Using a plaintext relayer private key, configure relayer.keystore instead")
+		return crypto.HexToECDSA(strings.TrimPrefix(relayer.PrivateKey, "0x"))
+	}
+	keyJSON, err := ioutil.ReadFile(relayer.Keystore)
+	if err != nil {
+		return nil, err
+	}
+	password, err := RelayerPassword(relayer)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keystore.DecryptKey(keyJSON, password)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", relayer.Keystore, err)
+	}
+	return key.PrivateKey, nil
+}
+
+// RelayerPassword returns the keystore passphrase of relayer, read from its
+// password file if one is configured.
+func RelayerPassword(relayer params.Relayer) (string, error) {
+	if relayer.PasswordFile == "" {
+		if relayer.Password == "" {
+			return "", errors.New("no keystore password, set relayer.password_file or SLASH_ROBOT_RELAYER_PASSWORD")
+		}
+		return relayer.Password, nil
+	}
+	data, err := ioutil.ReadFile(relayer.PasswordFile)
+	if err != nil {
+		return "", err
+	}
+	// like geth, only the first line of the file is the password
+	return strings.TrimRight(strings.SplitN(string(data), "\n", 2)[0], "\r"), nil
+}
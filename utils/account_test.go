@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"slash-robot/params"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestLoadRelayerKey(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := crypto.GenerateKey()
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	account, err := ks.ImportECDSA(key, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	passwordFile := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(passwordFile, []byte("secret\nignored\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadRelayerKey(params.Relayer{Keystore: account.URL.Path, PasswordFile: passwordFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crypto.PubkeyToAddress(loaded.PublicKey) != account.Address {
+		t.Error("wrong key loaded")
+	}
+	if _, err := LoadRelayerKey(params.Relayer{Keystore: account.URL.Path, Password: "wrong"}); err == nil {
+		t.Error("wrong password accepted")
+	}
+	if _, err := LoadRelayerKey(params.Relayer{Keystore: account.URL.Path}); err == nil {
+		t.Error("missing password accepted")
+	}
+}
@@ -0,0 +1,309 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"slash-robot/params"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+)
+
+// Layout of the parlia header extra data, see consensus/parlia in bsc:
+//
+//	vanity (32 bytes)
+//	epoch blocks only: validator count (1 byte), then per validator its
+//	    consensus address (20 bytes) and vote address (48 bytes)
+//	RLP encoded types.VoteAttestation, if the block carries one
+//	seal (65 bytes)
+const (
+	extraVanity        = 32
+	extraSeal          = 65
+	validatorCountSize = 1
+	validatorEntrySize = common.AddressLength + types.BLSPublicKeyLength
+)
+
+// epochValidator is a validator listed in an epoch header.
+type epochValidator struct {
+	Validator   common.Address
+	VoteAddress types.BLSPublicKey
+}
+
+// parseEpochValidators returns the validators listed in the extra data of an
+// epoch header, sorted by consensus address like the parlia snapshot.
+func parseEpochValidators(header *types.Header) ([]epochValidator, error) {
+	extra := header.Extra
+	if len(extra) <= extraVanity+extraSeal {
+		return nil, fmt.Errorf("block %d: extra data too short", header.Number)
+	}
+	num := int(extra[extraVanity])
+	start := extraVanity + validatorCountSize
+	if num == 0 || len(extra) < start+num*validatorEntrySize+extraSeal {
+		return nil, fmt.Errorf("block %d: no validators in extra data", header.Number)
+	}
+	validators := make([]epochValidator, num)
+	for i := range validators {
+		entry := extra[start+i*validatorEntrySize:]
+		copy(validators[i].Validator[:], entry[:common.AddressLength])
+		copy(validators[i].VoteAddress[:], entry[common.AddressLength:validatorEntrySize])
+	}
+	sort.Slice(validators, func(i, j int) bool {
+		return bytes.Compare(validators[i].Validator[:], validators[j].Validator[:]) < 0
+	})
+	return validators, nil
+}
+
+// parseAttestation returns the vote attestation in the extra data of header,
+// or nil if it carries none.
+func parseAttestation(header *types.Header) (*types.VoteAttestation, error) {
+	extra := header.Extra
+	if len(extra) <= extraVanity+extraSeal {
+		return nil, nil
+	}
+	start := extraVanity
+	if header.Number.Uint64()%params.EpochLength == 0 {
+		start += validatorCountSize + int(extra[extraVanity])*validatorEntrySize
+	}
+	if start >= len(extra)-extraSeal {
+		return nil, nil
+	}
+	var attestation types.VoteAttestation
+	if err := rlp.Decode(bytes.NewReader(extra[start:len(extra)-extraSeal]), &attestation); err != nil {
+		return nil, fmt.Errorf("block %d: decode attestation: %v", header.Number, err)
+	}
+	if attestation.Data == nil {
+		return nil, fmt.Errorf("block %d: attestation without vote data", header.Number)
+	}
+	return &attestation, nil
+}
+
+// attestationVotes returns one vote per validator whose bit is set in the
+// attestation, after checking the aggregated signature. validators must be
+// the set the attestation was made by. The votes carry no signature of their
+// own.
+func attestationVotes(attestation *types.VoteAttestation, validators []epochValidator) ([]*types.VoteEnvelope, []common.Address, error) {
+	var (
+		votes  []*types.VoteEnvelope
+		voters []common.Address
+		keys   []bls.PublicKey
+	)
+	for i, v := range validators {
+		if i >= 64 || attestation.VoteAddressSet&(1<<uint(i)) == 0 {
+			continue
+		}
+		key, err := bls.PublicKeyFromBytes(v.VoteAddress[:])
+		if err != nil {
+			return nil, nil, fmt.Errorf("vote address of %s: %v", v.Validator.Hex(), err)
+		}
+		keys = append(keys, key)
+		votes = append(votes, &types.VoteEnvelope{VoteAddress: v.VoteAddress, Data: attestation.Data})
+		voters = append(voters, v.Validator)
+	}
+	if len(keys) == 0 {
+		return nil, nil, nil
+	}
+	sig, err := bls.SignatureFromBytes(attestation.AggSignature[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	if !sig.FastAggregateVerify(keys, attestation.Data.Hash()) {
+		return nil, nil, errors.New("aggregated signature does not match")
+	}
+	return votes, voters, nil
+}
+
+// BackfilledVote is a vote recovered from a block attestation.
+type BackfilledVote struct {
+	Vote      *types.VoteEnvelope
+	Validator common.Address
+	Block     uint64
+}
+
+// Backfiller walks finalized headers and recovers the votes aggregated in
+// their attestations, so votes broadcast while the robot was not subscribed
+// still reach the detector. The last processed height is kept in a file, so
+// a restart continues where the previous run stopped.
+type Backfiller struct {
+	clients    *ClientPool
+	cursorPath string
+	votes      chan<- *BackfilledVote
+
+	finalized uint64 // atomic
+	notify    chan struct{}
+	cursor    uint64
+	epochs    map[uint64][]epochValidator
+}
+
+func NewBackfiller(clients *ClientPool, cursorPath string, votes chan<- *BackfilledVote) (*Backfiller, error) {
+	b := &Backfiller{
+		clients:    clients,
+		cursorPath: cursorPath,
+		votes:      votes,
+		notify:     make(chan struct{}, 1),
+		epochs:     make(map[uint64][]epochValidator),
+	}
+	data, err := ioutil.ReadFile(cursorPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if b.cursor, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err != nil {
+			return nil, fmt.Errorf("%s: %v", cursorPath, err)
+		}
+	}
+	return b, nil
+}
+
+// Finalized tells the backfiller about a new finalized header.
+func (b *Backfiller) Finalized(header *types.Header) {
+	atomic.StoreUint64(&b.finalized, header.Number.Uint64())
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run backfills whenever the finalized head advances, until ctx is done. The
+// cursor is saved before it returns.
+func (b *Backfiller) Run(ctx context.Context) {
+	defer func() {
+		if err := b.saveCursor(); err != nil {
+			backfillLog.Error("Failed to save cursor", "cursor", b.cursor, "err", err)
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.notify:
+		}
+		if err := b.backfill(ctx, atomic.LoadUint64(&b.finalized)); err != nil && ctx.Err() == nil {
+			backfillLog.Warn("Backfill failed", "cursor", b.cursor, "err", err)
+		}
+	}
+}
+
+// backfill processes the headers after the cursor up to finalized. Only the
+// last params.BackfillMaxBlocks are walked, older votes cannot be used as
+// evidence any more.
+func (b *Backfiller) backfill(ctx context.Context, finalized uint64) error {
+	from := b.cursor + 1
+	if finalized > params.BackfillMaxBlocks && from < finalized-params.BackfillMaxBlocks {
+		from = finalized - params.BackfillMaxBlocks
+	}
+	for number := from; number <= finalized; number++ {
+		if err := b.processBlock(ctx, number); err != nil {
+			return err
+		}
+		backfilledBlocksCounter.Inc()
+		b.cursor = number
+		if number%params.BackfillCursorInterval == 0 || number == finalized {
+			if err := b.saveCursor(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *Backfiller) processBlock(ctx context.Context, number uint64) error {
+	header, err := b.header(number)
+	if err != nil {
+		return err
+	}
+	attestation, err := parseAttestation(header)
+	if err != nil || attestation == nil {
+		if err != nil {
+			backfillLog.Warn("Invalid attestation", "block", number, "err", err)
+		}
+		return nil
+	}
+	// the attestation in block n is signed by the validators of the snapshot
+	// at block n-2, the parent of its target
+	if number < 2 {
+		return nil
+	}
+	validators, err := b.validatorsAt(number - 2)
+	if err != nil {
+		return err
+	}
+	votes, voters, err := attestationVotes(attestation, validators)
+	if err != nil {
+		backfillLog.Warn("Invalid attestation", "block", number, "err", err)
+		return nil
+	}
+	for i, vote := range votes {
+		select {
+		case b.votes <- &BackfilledVote{Vote: vote, Validator: voters[i], Block: number}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// validatorsAt returns the validators of the parlia snapshot at block number.
+// The validators listed in an epoch header take over once half of the
+// previous validators have sealed a block after it.
+func (b *Backfiller) validatorsAt(number uint64) ([]epochValidator, error) {
+	epoch := number - number%params.EpochLength
+	current, err := b.epochValidators(epoch)
+	if err != nil || epoch < params.EpochLength {
+		return current, err
+	}
+	previous, err := b.epochValidators(epoch - params.EpochLength)
+	if err != nil {
+		return nil, err
+	}
+	if number%params.EpochLength < uint64(len(previous)/2) {
+		return previous, nil
+	}
+	return current, nil
+}
+
+func (b *Backfiller) epochValidators(epoch uint64) ([]epochValidator, error) {
+	if validators, ok := b.epochs[epoch]; ok {
+		return validators, nil
+	}
+	header, err := b.header(epoch)
+	if err != nil {
+		return nil, err
+	}
+	validators, err := parseEpochValidators(header)
+	if err != nil {
+		return nil, err
+	}
+	// only the last two epochs are ever needed again
+	for cached := range b.epochs {
+		if cached+2*params.EpochLength < epoch {
+			delete(b.epochs, cached)
+		}
+	}
+	b.epochs[epoch] = validators
+	return validators, nil
+}
+
+func (b *Backfiller) header(number uint64) (*types.Header, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	header, err := b.clients.Client().HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return nil, fmt.Errorf("get header %d: %v", number, err)
+	}
+	return header, nil
+}
+
+func (b *Backfiller) saveCursor() error {
+	return writeFileAtomic(b.cursorPath, []byte(strconv.FormatUint(b.cursor, 10)+"\n"))
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	blscommon "github.com/prysmaticlabs/prysm/crypto/bls/common"
+)
+
+func TestBackfillAttestation(t *testing.T) {
+	var (
+		keys  []bls.SecretKey
+		extra = make([]byte, extraVanity, 256)
+	)
+	// validators listed in descending order, the snapshot sorts them
+	extra = append(extra, 3)
+	for i := 3; i > 0; i-- {
+		key, err := bls.RandKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append([]bls.SecretKey{key}, keys...)
+		extra = append(extra, common.BigToAddress(big.NewInt(int64(i))).Bytes()...)
+		extra = append(extra, key.PublicKey().Marshal()...)
+	}
+	extra = append(extra, make([]byte, extraSeal)...)
+	epoch := &types.Header{Number: big.NewInt(200), Extra: extra}
+
+	validators, err := parseEpochValidators(epoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range validators {
+		if v.Validator != common.BigToAddress(big.NewInt(int64(i+1))) || !bytes.Equal(v.VoteAddress[:], keys[i].PublicKey().Marshal()) {
+			t.Fatalf("validator %d: %s", i, v.Validator.Hex())
+		}
+	}
+	if attestation, err := parseAttestation(epoch); err != nil || attestation != nil {
+		t.Fatal("attestation in epoch header without one", err)
+	}
+
+	// validators 0 and 2 vote
+	data := &types.VoteData{SourceNumber: 201, TargetNumber: 202, SourceHash: common.HexToHash("0x01"), TargetHash: common.HexToHash("0x02")}
+	hash := data.Hash()
+	attestation := &types.VoteAttestation{
+		VoteAddressSet: 1<<0 | 1<<2,
+		Data:           data,
+	}
+	copy(attestation.AggSignature[:], bls.AggregateSignatures([]blscommon.Signature{keys[0].Sign(hash[:]), keys[2].Sign(hash[:])}).Marshal())
+	enc, err := rlp.EncodeToBytes(attestation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := &types.Header{Number: big.NewInt(203), Extra: append(append(make([]byte, extraVanity), enc...), make([]byte, extraSeal)...)}
+
+	parsed, err := parseAttestation(header)
+	if err != nil || parsed == nil {
+		t.Fatal("parse attestation", err)
+	}
+	votes, voters, err := attestationVotes(parsed, validators)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(votes) != 2 || voters[0] != validators[0].Validator || voters[1] != validators[2].Validator {
+		t.Fatal("bad voters", voters)
+	}
+	if votes[1].VoteAddress != validators[2].VoteAddress || *votes[1].Data != *data {
+		t.Fatal("bad vote", votes[1])
+	}
+
+	parsed.VoteAddressSet = 1<<0 | 1<<1
+	if _, _, err := attestationVotes(parsed, validators); err == nil {
+		t.Fatal("attestation with wrong voters accepted")
+	}
+}
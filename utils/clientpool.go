@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slash-robot/params"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ParseEndpoints turns the -client flag, a comma separated list of endpoint
+// names or URLs in order of preference, into URLs.
+func ParseEndpoints(clientEntered string) []string {
+	var urls []string
+	for _, name := range strings.Split(clientEntered, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+		case "bsc_testnet":
+			urls = append(urls, params.BSCTestnet)
+		case "bsc":
+			urls = append(urls, params.BSC)
+		case "geth_ipc":
+			urls = append(urls, params.GethIpc)
+		case "geth_ws":
+			urls = append(urls, params.GethWS)
+		default:
+			urls = append(urls, name)
+		}
+	}
+	return urls
+}
+
+// CheckEndpoint reports why client is not fit to use: it serves another
+// chain, or its head is older than params.MaxHeadAge.
+func CheckEndpoint(client *ethclient.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return fmt.Errorf("get chain id: %v", err)
+	}
+	if chainID.Cmp(ChainId) != 0 {
+		return fmt.Errorf("chain id %s, want %s", chainID, ChainId)
+	}
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("get head: %v", err)
+	}
+	if age := time.Since(time.Unix(int64(head.Time), 0)); age > params.MaxHeadAge {
+		return fmt.Errorf("head %d is %s old", head.Number, age.Round(time.Second))
+	}
+	return nil
+}
+
+// ClientPool holds connections to several nodes of the same chain. Client
+// returns the first healthy endpoint in order of preference; Run checks the
+// endpoints periodically and fails over, and back, accordingly.
+type ClientPool struct {
+	urls []string
+
+	mu      sync.Mutex
+	clients []*ethclient.Client // nil until dialed
+	current int
+}
+
+// NewClientPool dials the endpoints and selects the first healthy one. It
+// fails only if none is healthy.
+func NewClientPool(urls []string) (*ClientPool, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("no endpoints")
+	}
+	p := &ClientPool{urls: urls, clients: make([]*ethclient.Client, len(urls)), current: -1}
+	if !p.check() {
+		return nil, errors.New("no healthy endpoint")
+	}
+	return p, nil
+}
+
+func (p *ClientPool) Len() int {
+	return len(p.urls)
+}
+
+// Client returns the client of the selected endpoint.
+func (p *ClientPool) Client() *ethclient.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.clients[p.current]
+}
+
+// Endpoint returns the client of endpoint i, dialing it if needed.
+func (p *ClientPool) Endpoint(i int) (*ethclient.Client, error) {
+	p.mu.Lock()
+	client := p.clients[i]
+	p.mu.Unlock()
+	if client != nil {
+		return client, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	client, err := ethclient.DialContext(ctx, p.urls[i])
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.clients[i] != nil {
+		client.Close()
+		return p.clients[i], nil
+	}
+	p.clients[i] = client
+	return client, nil
+}
+
+// Run checks the endpoints every params.EndpointCheckInterval until ctx is
+// done.
+func (p *ClientPool) Run(ctx context.Context) {
+	ticker := time.NewTicker(params.EndpointCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.check()
+		}
+	}
+}
+
+// check selects the first healthy endpoint and reports whether there is one.
+// If none is healthy, the selection is kept.
+func (p *ClientPool) check() bool {
+	for i, url := range p.urls {
+		client, err := p.Endpoint(i)
+		if err == nil {
+			err = CheckEndpoint(client)
+		}
+		if err != nil {
+			endpointHealthyGauge.WithLabelValues(url).Set(0)
+			endpointLog.Warn("Endpoint unhealthy", "url", url, "err", err)
+			continue
+		}
+		endpointHealthyGauge.WithLabelValues(url).Set(1)
+		p.mu.Lock()
+		if p.current != i {
+			if p.current >= 0 {
+				endpointFailoversCounter.Inc()
+			}
+			p.current = i
+			endpointLog.Info("Connected to endpoint", "url", url)
+		}
+		p.mu.Unlock()
+		return true
+	}
+	return false
+}
+
+func (p *ClientPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, client := range p.clients {
+		if client != nil {
+			client.Close()
+			p.clients[i] = nil
+		}
+	}
+}
+
+// take returns the client of the selected endpoint and closes the others. The
+// pool is not usable afterwards.
+func (p *ClientPool) take() *ethclient.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	client := p.clients[p.current]
+	for i, other := range p.clients {
+		if other != nil && other != client {
+			other.Close()
+		}
+		p.clients[i] = nil
+	}
+	return client
+}
+
+// The methods below let the pool stand in for a client in the TxSender, the
+// Submitter and contract bindings, always using the selected endpoint.
+
+func (p *ClientPool) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return p.Client().CodeAt(ctx, contract, blockNumber)
+}
+
+func (p *ClientPool) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return p.Client().CallContract(ctx, call, blockNumber)
+}
+
+func (p *ClientPool) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return p.Client().PendingNonceAt(ctx, account)
+}
+
+func (p *ClientPool) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return p.Client().SuggestGasPrice(ctx)
+}
+
+func (p *ClientPool) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	return p.Client().EstimateGas(ctx, msg)
+}
+
+func (p *ClientPool) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return p.Client().SendTransaction(ctx, tx)
+}
+
+func (p *ClientPool) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return p.Client().HeaderByNumber(ctx, number)
+}
+
+func (p *ClientPool) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	return p.Client().TransactionReceipt(ctx, txHash)
+}
+
+// VoteDeduplicator drops votes already received from another endpoint. It
+// remembers the last params.VoteDedupSize votes.
+type VoteDeduplicator struct {
+	seen   map[common.Hash]struct{}
+	recent []common.Hash
+	next   int
+}
+
+func NewVoteDeduplicator(size int) *VoteDeduplicator {
+	return &VoteDeduplicator{seen: make(map[common.Hash]struct{}, size), recent: make([]common.Hash, size)}
+}
+
+// Seen reports whether vote was received before, and remembers it otherwise.
+func (d *VoteDeduplicator) Seen(vote *types.VoteEnvelope) bool {
+	hash := vote.Hash()
+	if _, ok := d.seen[hash]; ok {
+		return true
+	}
+	delete(d.seen, d.recent[d.next])
+	d.recent[d.next] = hash
+	d.next = (d.next + 1) % len(d.recent)
+	d.seen[hash] = struct{}{}
+	return false
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"reflect"
+	"slash-robot/params"
+	"testing"
+)
+
+func TestParseEndpoints(t *testing.T) {
+	urls := ParseEndpoints("geth_ws, ws://10.0.0.2:8546,,bsc")
+	want := []string{params.GethWS, "ws://10.0.0.2:8546", params.BSC}
+	if !reflect.DeepEqual(urls, want) {
+		t.Fatalf("have %v, want %v", urls, want)
+	}
+}
+
+func TestVoteDeduplicator(t *testing.T) {
+	dedup := NewVoteDeduplicator(2)
+	vote1, vote2, vote3 := newTestVote(walTestVoteAddr, 1, 2), newTestVote(walTestVoteAddr, 2, 3), newTestVote(walTestVoteAddr, 3, 4)
+	if dedup.Seen(vote1) || dedup.Seen(vote2) {
+		t.Fatal("new vote reported as seen")
+	}
+	if !dedup.Seen(newTestVote(walTestVoteAddr, 1, 2)) {
+		t.Fatal("copy of vote not reported as seen")
+	}
+	// the oldest vote is forgotten once the capacity is exceeded
+	if dedup.Seen(vote3) || dedup.Seen(vote1) {
+		t.Fatal("forgotten vote reported as seen")
+	}
+	if !dedup.Seen(vote3) {
+		t.Fatal("recent vote not reported as seen")
+	}
+}
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"syscall"
+
+	"github.com/prometheus/tsdb/fileutil"
+)
+
+// ErrDataDirLocked is returned by LockDataDir when another process, such as a
+// running monitor, holds the data directory.
+var ErrDataDirLocked = errors.New("data directory in use by another process")
+
+// LockDataDir takes the lock of the data directory dir, so that the vote
+// store and the evidence queue in it have a single writer. The lock is held
+// until the returned releaser is called or the process exits.
+func LockDataDir(dir string) (fileutil.Releaser, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	lock, _, err := fileutil.Flock(path.Join(dir, "LOCK"))
+	if errors.Is(err, syscall.EWOULDBLOCK) || errors.Is(err, syscall.EAGAIN) {
+		return nil, ErrDataDirLocked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock data directory: %w", err)
+	}
+	return lock, nil
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+)
+
+func TestLockDataDir(t *testing.T) {
+	dir := t.TempDir()
+	lock, err := LockDataDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LockDataDir(dir); err != ErrDataDirLocked {
+		t.Fatal("second lock taken:", err)
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+	lock, err = LockDataDir(dir)
+	if err != nil {
+		t.Fatal("lock not released:", err)
+	}
+	_ = lock.Release()
+
+	// failing to open the lock file is not reported as a running monitor
+	broken := t.TempDir()
+	if err := os.Mkdir(path.Join(broken, "LOCK"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LockDataDir(broken); err == ErrDataDirLocked || !errors.Is(err, syscall.EISDIR) {
+		t.Fatal("bad error for unusable lock file:", err)
+	}
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ViolationType is the fast finality rule broken by a pair of votes.
+type ViolationType int
+
+const (
+	// DoubleVote is two different votes for the same target.
+	DoubleVote ViolationType = iota + 1
+	// SurroundingVote is a new vote whose span surrounds a stored vote.
+	SurroundingVote
+	// SurroundedVote is a new vote whose span is surrounded by a stored vote.
+	SurroundedVote
+)
+
+func (t ViolationType) String() string {
+	switch t {
+	case DoubleVote:
+		return "double vote"
+	case SurroundingVote:
+		return "surrounding vote"
+	case SurroundedVote:
+		return "surrounded vote"
+	default:
+		return fmt.Sprintf("ViolationType(%d)", int(t))
+	}
+}
+
+// Violation is a slashable pair of votes signed by the same validator.
+type Violation struct {
+	Type      ViolationType
+	Validator common.Address      // consensus address of the validator
+	Vote      *types.VoteEnvelope // the vote that was just received
+	Conflict  *types.VoteEnvelope // the stored vote it conflicts with
+}
+
+// Provable reports whether both votes carry their own signature, which
+// SlashIndicator requires as evidence. Votes recovered from block
+// attestations only come with the aggregated signature.
+func (v *Violation) Provable() bool {
+	return v.Vote.Signature != (types.BLSSignature{}) && v.Conflict.Signature != (types.BLSSignature{})
+}
+
+// checkVotePair returns the rule broken by votes a and b of one validator, or
+// 0 if they may both be signed. These are the rules SlashIndicator enforces
+// in submitFinalityViolationEvidence.
+func checkVotePair(a, b *types.VoteData) ViolationType {
+	switch {
+	case *a == *b:
+		return 0
+	case a.TargetNumber == b.TargetNumber:
+		return DoubleVote
+	case a.SourceNumber < b.SourceNumber && b.TargetNumber < a.TargetNumber:
+		return SurroundingVote
+	case b.SourceNumber < a.SourceNumber && a.TargetNumber < b.TargetNumber:
+		return SurroundedVote
+	}
+	return 0
+}
+
+// CheckVote compares vote of validator with its history in store. It returns
+// false and the violation when vote is slashable; otherwise vote is added to
+// the history.
+//
+// Only the target index of store is consulted: a stored vote can only be
+// surrounded by vote if its target lies inside (source, target) of vote, and
+// can only surround vote if its target lies above the target of vote.
+func CheckVote(vote *types.VoteEnvelope, validator common.Address, store VoteStore) (bool, *Violation) {
+	voteAddr := vote.VoteAddress
+	voteData := vote.Data
+	if voteData.SourceNumber >= voteData.TargetNumber {
+		detectorLog.Warn("Malformed vote", "vote_address", common.Bytes2Hex(voteAddr.Bytes()), "validator", validator.Hex(), "source", voteData.SourceNumber, "target", voteData.TargetNumber)
+		return true, nil
+	}
+
+	// 1. no double vote
+	prev, err := store.Get(voteAddr, voteData.TargetNumber)
+	if err != nil {
+		storeLog.Error("Failed to read vote store", "vote_address", common.Bytes2Hex(voteAddr.Bytes()), "target", voteData.TargetNumber, "err", err)
+	} else if prev != nil {
+		if t := checkVotePair(voteData, prev.Vote.Data); t != 0 {
+			return false, detected(&Violation{Type: t, Validator: validator, Vote: vote, Conflict: prev.Vote})
+		}
+		// keep the signed copy of a vote first seen in an attestation
+		if prev.Vote.Signature == (types.BLSSignature{}) && vote.Signature != (types.BLSSignature{}) {
+			if err := store.Put(validator, vote); err != nil {
+				storeLog.Error("Failed to write vote store", "vote_address", common.Bytes2Hex(voteAddr.Bytes()), "target", voteData.TargetNumber, "err", err)
+			}
+		}
+		return true, nil
+	}
+
+	// 2. no vote surrounding or surrounded by another one
+	var violation *Violation
+	find := func(prev *StoredVote) bool {
+		if t := checkVotePair(voteData, prev.Vote.Data); t != 0 {
+			violation = &Violation{Type: t, Validator: validator, Vote: vote, Conflict: prev.Vote}
+			return false
+		}
+		return true
+	}
+	if err := store.RangeByTarget(voteAddr, voteData.SourceNumber+1, voteData.TargetNumber-1, find); err != nil {
+		storeLog.Error("Failed to read vote store", "vote_address", common.Bytes2Hex(voteAddr.Bytes()), "target", voteData.TargetNumber, "err", err)
+	}
+	if violation == nil && voteData.TargetNumber < math.MaxUint64 {
+		if err := store.RangeByTarget(voteAddr, voteData.TargetNumber+1, math.MaxUint64, find); err != nil {
+			storeLog.Error("Failed to read vote store", "vote_address", common.Bytes2Hex(voteAddr.Bytes()), "target", voteData.TargetNumber, "err", err)
+		}
+	}
+	if violation != nil {
+		return false, detected(violation)
+	}
+
+	if err := store.Put(validator, vote); err != nil {
+		storeLog.Error("Failed to write vote store", "vote_address", common.Bytes2Hex(voteAddr.Bytes()), "target", voteData.TargetNumber, "err", err)
+	}
+	return true, nil
+}
+
+// detected logs and counts violation and returns it.
+func detected(violation *Violation) *Violation {
+	detectorLog.Warn("Violation detected", violation.LogCtx()...)
+	violationsCounter.WithLabelValues(strings.ReplaceAll(violation.Type.String(), " ", "_")).Inc()
+	return violation
+}
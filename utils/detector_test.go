@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestCheckVoteViolations(t *testing.T) {
+	tests := []struct {
+		name           string
+		stored         [][2]uint64
+		src, tar       uint64
+		otherTarHash   bool
+		wantViolation  ViolationType
+		wantConflictAt uint64
+	}{
+		{name: "consecutive votes", stored: [][2]uint64{{9, 10}, {10, 11}}, src: 11, tar: 12},
+		{name: "identical vote", stored: [][2]uint64{{9, 10}}, src: 9, tar: 10},
+		{name: "double vote", stored: [][2]uint64{{9, 10}}, src: 9, tar: 10, otherTarHash: true, wantViolation: DoubleVote, wantConflictAt: 10},
+		{name: "surrounding", stored: [][2]uint64{{5, 6}}, src: 4, tar: 7, wantViolation: SurroundingVote, wantConflictAt: 6},
+		{name: "surrounded", stored: [][2]uint64{{2, 20}}, src: 5, tar: 6, wantViolation: SurroundedVote, wantConflictAt: 20},
+		{name: "same source", stored: [][2]uint64{{5, 10}}, src: 5, tar: 12},
+		{name: "adjacent spans", stored: [][2]uint64{{5, 10}}, src: 10, tar: 12},
+		{name: "overlapping spans", stored: [][2]uint64{{5, 10}}, src: 7, tar: 12},
+	}
+	for _, test := range tests {
+		store := &VotesRecordStore{VoteRecord: make(map[types.BLSPublicKey]map[uint64]*types.VoteEnvelope)}
+		for _, span := range test.stored {
+			_ = store.Put(testValidator, newTestVote(walTestVoteAddr, span[0], span[1]))
+		}
+		vote := newTestVote(walTestVoteAddr, test.src, test.tar)
+		if test.otherTarHash {
+			vote.Data.TargetHash = common.BigToHash(common.Big3)
+		}
+
+		ok, violation := CheckVote(vote, testValidator, store)
+		if test.wantViolation == 0 {
+			if !ok {
+				t.Errorf("%s: unexpected %s", test.name, violation.Type)
+			}
+			continue
+		}
+		if ok {
+			t.Errorf("%s: violation not detected", test.name)
+			continue
+		}
+		if violation.Type != test.wantViolation || violation.Conflict.Data.TargetNumber != test.wantConflictAt {
+			t.Errorf("%s: got %s against target %d", test.name, violation.Type, violation.Conflict.Data.TargetNumber)
+		}
+	}
+}
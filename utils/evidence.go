@@ -0,0 +1,262 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type EvidenceStatus string
+
+const (
+	// EvidencePending is waiting for its first or next submission attempt.
+	EvidencePending EvidenceStatus = "pending"
+	// EvidenceSubmitted has a transaction in flight.
+	EvidenceSubmitted EvidenceStatus = "submitted"
+	// EvidenceIncluded slashed the validator in a block that is not finalized
+	// yet, a reorg may still drop it.
+	EvidenceIncluded EvidenceStatus = "included"
+
+	// final outcomes
+	// EvidenceSettled slashed the validator in a finalized block.
+	EvidenceSettled EvidenceStatus = "settled"
+	// EvidenceReverted was mined in a transaction that failed.
+	EvidenceReverted   EvidenceStatus = "reverted"
+	EvidenceSuperseded EvidenceStatus = "superseded"
+	EvidenceExpired    EvidenceStatus = "expired"
+	// EvidenceRejected failed the eth_call simulation, or could not be sent
+	// for a reason no retry can fix.
+	EvidenceRejected EvidenceStatus = "rejected"
+	// EvidenceUnconfirmed was mined successfully, but SlashIndicator did not
+	// slash the validator.
+	EvidenceUnconfirmed EvidenceStatus = "unconfirmed"
+)
+
+// Final reports whether no more submissions will be made for the evidence.
+func (s EvidenceStatus) Final() bool {
+	return s != EvidencePending && s != EvidenceSubmitted && s != EvidenceIncluded
+}
+
+// Failed reports whether the evidence ended without slashing the validator,
+// while no other evidence did it either.
+func (s EvidenceStatus) Failed() bool {
+	return s == EvidenceReverted || s == EvidenceExpired || s == EvidenceRejected || s == EvidenceUnconfirmed
+}
+
+// Evidence is a detected violation waiting in the EvidenceQueue to be
+// submitted to SlashIndicator, together with the state of its submission.
+type Evidence struct {
+	ID        common.Hash
+	Type      ViolationType
+	Validator common.Address
+	VoteA     *types.VoteEnvelope
+	VoteB     *types.VoteEnvelope
+
+	Status      EvidenceStatus
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+	// RevertReason is the decoded reason SlashIndicator rejected the evidence
+	RevertReason string
+	// TxHash is the latest transaction sent for the evidence, TxHashes holds
+	// every one of them
+	TxHash   common.Hash
+	TxHashes []common.Hash
+	Nonce    uint64
+	SpeedUps int
+	// SubmittedAt and SubmittedBlock are the time and head when TxHash was sent
+	SubmittedAt    time.Time
+	SubmittedBlock uint64
+	// Outcome is what the mined evidence transaction did on chain
+	Outcome *SlashOutcome
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// EvidenceID identifies the evidence for a pair of votes independently of the
+// order they were seen in.
+func EvidenceID(voteA, voteB *types.VoteEnvelope) common.Hash {
+	hashA, hashB := voteA.Data.Hash(), voteB.Data.Hash()
+	if bytes.Compare(hashA[:], hashB[:]) > 0 {
+		hashA, hashB = hashB, hashA
+	}
+	return crypto.Keccak256Hash(voteA.VoteAddress.Bytes(), hashA.Bytes(), hashB.Bytes())
+}
+
+func (e *Evidence) minTarget() uint64 {
+	if e.VoteB.Data.TargetNumber < e.VoteA.Data.TargetNumber {
+		return e.VoteB.Data.TargetNumber
+	}
+	return e.VoteA.Data.TargetNumber
+}
+
+// Expired reports whether SlashIndicator rejects the evidence at block head,
+// which is the case once either vote target is evidenceWindow blocks old.
+func (e *Evidence) Expired(head, evidenceWindow uint64) bool {
+	return e.minTarget()+evidenceWindow <= head
+}
+
+// EvidenceQueue is a durable queue of evidence. Every item is written to its
+// own file under dir before any method that changes it returns, so detected
+// violations survive restarts and failed submissions.
+type EvidenceQueue struct {
+	dir    string
+	mu     sync.Mutex
+	items  map[common.Hash]*Evidence
+	notify chan struct{}
+}
+
+func NewEvidenceQueue(dir string) (*EvidenceQueue, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	q := &EvidenceQueue{
+		dir:    dir,
+		items:  make(map[common.Hash]*Evidence),
+		notify: make(chan struct{}, 1),
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(path.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		e := new(Evidence)
+		if err := json.Unmarshal(data, e); err != nil {
+			return nil, fmt.Errorf("%s: %v", file.Name(), err)
+		}
+		q.items[e.ID] = e
+	}
+	return q, nil
+}
+
+func (q *EvidenceQueue) path(id common.Hash) string {
+	return path.Join(q.dir, id.Hex()+".json")
+}
+
+func (q *EvidenceQueue) persist(e *Evidence) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(q.path(e.ID), data)
+}
+
+// Add queues the evidence for violation. It returns false if the same pair of
+// votes is already queued.
+func (q *EvidenceQueue) Add(violation *Violation) (*Evidence, bool, error) {
+	id := EvidenceID(violation.Vote, violation.Conflict)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if e, ok := q.items[id]; ok {
+		cp := *e
+		return &cp, false, nil
+	}
+	now := time.Now()
+	e := &Evidence{
+		ID:          id,
+		Type:        violation.Type,
+		Validator:   violation.Validator,
+		VoteA:       violation.Vote,
+		VoteB:       violation.Conflict,
+		Status:      EvidencePending,
+		NextAttempt: now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := q.persist(e); err != nil {
+		return nil, false, err
+	}
+	cp := *e
+	q.items[id] = &cp
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return e, true, nil
+}
+
+// Update persists the changed state of e.
+func (q *EvidenceQueue) Update(e *Evidence) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e.UpdatedAt = time.Now()
+	if err := q.persist(e); err != nil {
+		return err
+	}
+	cp := *e
+	q.items[e.ID] = &cp
+	return nil
+}
+
+// Get returns a copy of the evidence with the given id. Changes to it are
+// kept by passing it to Update.
+func (q *EvidenceQueue) Get(id common.Hash) (*Evidence, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.items[id]
+	if !ok {
+		return nil, false
+	}
+	cp := *e
+	return &cp, true
+}
+
+// Items returns copies of the queued evidence matching filter, oldest first.
+// A nil filter matches everything.
+func (q *EvidenceQueue) Items(filter func(*Evidence) bool) []*Evidence {
+	q.mu.Lock()
+	var items []*Evidence
+	for _, e := range q.items {
+		if filter == nil || filter(e) {
+			cp := *e
+			items = append(items, &cp)
+		}
+	}
+	q.mu.Unlock()
+	sort.Slice(items, func(i, j int) bool { return items[i].CreatedAt.Before(items[j].CreatedAt) })
+	return items
+}
+
+// Notify fires when evidence is added to the queue.
+func (q *EvidenceQueue) Notify() <-chan struct{} {
+	return q.notify
+}
+
+func writeFileAtomic(filePath string, data []byte) error {
+	tmp := filePath + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filePath)
+}
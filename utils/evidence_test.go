@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"errors"
+	"slash-robot/params"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func newTestViolation(srcNum, tarNum uint64) *Violation {
+	vote := newTestVote(walTestVoteAddr, srcNum, tarNum)
+	conflict := newTestVote(walTestVoteAddr, srcNum, tarNum)
+	conflict.Data.TargetHash = common.BigToHash(common.Big3)
+	return &Violation{Type: DoubleVote, Validator: testValidator, Vote: vote, Conflict: conflict}
+}
+
+func TestEvidenceQueue(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := NewEvidenceQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	violation := newTestViolation(9, 10)
+	e, added, err := queue.Add(violation)
+	if err != nil || !added {
+		t.Fatal("add evidence", added, err)
+	}
+	swapped := &Violation{Type: DoubleVote, Validator: testValidator, Vote: violation.Conflict, Conflict: violation.Vote}
+	if _, added, _ := queue.Add(swapped); added {
+		t.Error("same vote pair queued twice")
+	}
+
+	e.Status = EvidenceSubmitted
+	e.Attempts = 2
+	if err := queue.Update(e); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewEvidenceQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := reopened.Get(e.ID)
+	if !ok || got.Status != EvidenceSubmitted || got.Attempts != 2 || got.Validator != testValidator || got.Type != DoubleVote {
+		t.Error("evidence not restored", got)
+	}
+	if items := reopened.Items(func(e *Evidence) bool { return !e.Status.Final() }); len(items) != 1 {
+		t.Error("open evidence, want 1 got", len(items))
+	}
+}
+
+func TestEvidenceExpired(t *testing.T) {
+	e := &Evidence{VoteA: newTestVote(walTestVoteAddr, 9, 10), VoteB: newTestVote(walTestVoteAddr, 5, 20)}
+	if e.Expired(10+params.EvidenceWindow-1, params.EvidenceWindow) {
+		t.Error("evidence expired inside the window")
+	}
+	if !e.Expired(10+params.EvidenceWindow, params.EvidenceWindow) {
+		t.Error("evidence not expired outside the window")
+	}
+}
+
+func TestSubmitErrors(t *testing.T) {
+	if IsRetriableSubmitError(errors.New("execution reverted: target block too old")) {
+		t.Error("revert classified as retriable")
+	}
+	if !IsRetriableSubmitError(errors.New("dial tcp 127.0.0.1:8547: connect: connection refused")) {
+		t.Error("connection error classified as permanent")
+	}
+	if SubmitBackoff(1) != params.SubmitBackoffMin || SubmitBackoff(2) != 2*params.SubmitBackoffMin {
+		t.Error("backoff not exponential", SubmitBackoff(1), SubmitBackoff(2))
+	}
+	if SubmitBackoff(100) != params.SubmitBackoffMax {
+		t.Error("backoff not capped", SubmitBackoff(100))
+	}
+}
+
+func TestEvidenceStatusFinal(t *testing.T) {
+	for _, status := range []EvidenceStatus{EvidencePending, EvidenceSubmitted, EvidenceIncluded} {
+		if status.Final() {
+			t.Errorf("%s is final", status)
+		}
+	}
+	for _, status := range []EvidenceStatus{EvidenceSettled, EvidenceReverted, EvidenceSuperseded, EvidenceExpired, EvidenceRejected, EvidenceUnconfirmed} {
+		if !status.Final() {
+			t.Errorf("%s is not final", status)
+		}
+	}
+}
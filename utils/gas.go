@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"errors"
+	"math/big"
+	"slash-robot/params"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// The go-ethereum fork this robot builds against only knows legacy and access
+// list transactions, like the BSC chain itself, so fees are a single gas
+// price. There are no EIP-1559 fee fields to fill in.
+
+var errGasPriceCeiling = errors.New("gas price already at ceiling")
+
+// GasLimit returns the gas limit for a transaction estimated to need estimate
+// gas: the estimate times params.GasLimitMultiplier, kept between
+// params.MinGasLimit and params.MaxGasLimit.
+func GasLimit(estimate uint64) uint64 {
+	limit := uint64(float64(estimate) * params.GasLimitMultiplier)
+	if limit < params.MinGasLimit {
+		limit = params.MinGasLimit
+	}
+	if limit > params.MaxGasLimit {
+		limit = params.MaxGasLimit
+	}
+	return limit
+}
+
+// GasPrice returns the gas price to pay when the node suggests suggested: the
+// suggestion times params.GasPriceMultiplier, kept between params.MinGasPrice
+// and params.MaxGasPrice.
+func GasPrice(suggested *big.Int) *big.Int {
+	price, _ := new(big.Float).Mul(new(big.Float).SetInt(suggested), big.NewFloat(params.GasPriceMultiplier)).Int(nil)
+	return clampGasPrice(price)
+}
+
+func clampGasPrice(price *big.Int) *big.Int {
+	if min := gwei(params.MinGasPriceGwei); price.Cmp(min) < 0 {
+		return min
+	}
+	if max := gwei(params.MaxGasPriceGwei); price.Cmp(max) > 0 {
+		return max
+	}
+	return price
+}
+
+// bumpGasPrice raises price by params.ReplacementBumpPercent, enough for the
+// transaction pool to accept a replacement, but not above params.MaxGasPrice.
+func bumpGasPrice(price *big.Int) (*big.Int, error) {
+	bumped := new(big.Int).Mul(price, big.NewInt(100+int64(params.ReplacementBumpPercent)))
+	bumped.Div(bumped, big.NewInt(100))
+	if bumped.Cmp(price) <= 0 {
+		bumped.Add(price, common.Big1)
+	}
+	if bumped = clampGasPrice(bumped); bumped.Cmp(price) <= 0 {
+		return nil, errGasPriceCeiling
+	}
+	return bumped, nil
+}
+
+func gwei(n uint64) *big.Int {
+	return new(big.Int).Mul(new(big.Int).SetUint64(n), big.NewInt(1e9))
+}
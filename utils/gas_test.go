@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"math/big"
+	"slash-robot/params"
+	"testing"
+)
+
+func TestGasLimit(t *testing.T) {
+	tests := []struct{ estimate, limit uint64 }{
+		{0, params.MinGasLimit},
+		{1000000, 1300000},
+		{1e9, params.MaxGasLimit},
+	}
+	for _, test := range tests {
+		if limit := GasLimit(test.estimate); limit != test.limit {
+			t.Errorf("estimate %d: limit %d, want %d", test.estimate, limit, test.limit)
+		}
+	}
+}
+
+func TestGasPrice(t *testing.T) {
+	tests := []struct{ suggested, price *big.Int }{
+		{big.NewInt(1), gwei(params.MinGasPriceGwei)},
+		{gwei(10), gwei(11)},
+		{gwei(1000), gwei(params.MaxGasPriceGwei)},
+	}
+	for _, test := range tests {
+		if price := GasPrice(test.suggested); price.Cmp(test.price) != 0 {
+			t.Errorf("suggested %v: price %v, want %v", test.suggested, price, test.price)
+		}
+	}
+
+	bumped, err := bumpGasPrice(gwei(10))
+	if err != nil || bumped.Cmp(big.NewInt(11.2e9)) != 0 {
+		t.Fatal("bump", bumped, err)
+	}
+	if bumped, err := bumpGasPrice(gwei(95)); err != nil || bumped.Cmp(gwei(params.MaxGasPriceGwei)) != 0 {
+		t.Fatal("bump near ceiling", bumped, err)
+	}
+	if _, err := bumpGasPrice(gwei(params.MaxGasPriceGwei)); err != errGasPriceCeiling {
+		t.Fatal("bump at ceiling", err)
+	}
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slash-robot/abi"
+	"slash-robot/params"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Health holds what the readiness of the robot depends on: a live vote feed,
+// an advancing finalized head, and a registered relayer able to pay for
+// evidence.
+type Health struct {
+	mu                  sync.Mutex
+	lastVote            time.Time
+	finalized           uint64
+	finalizedAt         time.Time
+	balance             *big.Int
+	registered, checked bool
+}
+
+// NewHealth returns the health of a robot started at now. The vote feed and
+// finalized head get their timeouts from now on to deliver the first time.
+func NewHealth(now time.Time) *Health {
+	return &Health{lastVote: now, finalizedAt: now}
+}
+
+// health is the state served at /healthz and /readyz, fed by the Observe and
+// Update functions alongside the metrics.
+var health = NewHealth(time.Now())
+
+func (h *Health) voteReceived(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastVote = now
+}
+
+func (h *Health) finalizedReceived(number uint64, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if number > h.finalized {
+		h.finalized, h.finalizedAt = number, now
+	}
+}
+
+func (h *Health) setBalance(balance *big.Int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.balance = balance
+}
+
+func (h *Health) setRegistered(registered bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.registered, h.checked = registered, true
+}
+
+// NotReady returns why the robot is not ready at now, nothing if it is.
+func (h *Health) NotReady(now time.Time) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var reasons []string
+	if silence := now.Sub(h.lastVote); silence > params.ReadyVoteTimeout {
+		reasons = append(reasons, fmt.Sprintf("no vote received for %s", silence.Round(time.Second)))
+	}
+	if stall := now.Sub(h.finalizedAt); stall > params.ReadyFinalizedTimeout {
+		reasons = append(reasons, fmt.Sprintf("finalized head stuck at %d for %s", h.finalized, stall.Round(time.Second)))
+	}
+	reserve := new(big.Int).Mul(new(big.Int).SetUint64(params.GasReserveGwei), big.NewInt(1e9))
+	if h.balance == nil {
+		reasons = append(reasons, "relayer balance not known yet")
+	} else if h.balance.Cmp(reserve) < 0 {
+		reasons = append(reasons, fmt.Sprintf("relayer balance %s wei below the gas reserve of %s wei", h.balance, reserve))
+	}
+	if !h.checked {
+		reasons = append(reasons, "relayer registration not known yet")
+	} else if !h.registered {
+		reasons = append(reasons, "relayer not registered at RelayerHub")
+	}
+	return reasons
+}
+
+// UpdateRelayerRegistration checks whether account is a registered relayer.
+func UpdateRelayerRegistration(caller bind.ContractCaller, account common.Address) error {
+	relayerHub, err := abi.NewRelayerhubCaller(RelayerHubAddr, caller)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	registered, err := relayerHub.IsRelayer(&bind.CallOpts{Context: ctx}, account)
+	if err != nil {
+		return err
+	}
+	health.setRegistered(registered)
+	return nil
+}
+
+// healthz answers as long as the process serves requests.
+func healthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// readyz fails with the reasons the robot is not ready.
+func readyz(w http.ResponseWriter, r *http.Request) {
+	if reasons := health.NotReady(time.Now()); len(reasons) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, strings.Join(reasons, "\n"))
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
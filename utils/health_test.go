@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"math/big"
+	"slash-robot/params"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthNotReady(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	h := NewHealth(start)
+	reserve := new(big.Int).Mul(new(big.Int).SetUint64(params.GasReserveGwei), big.NewInt(1e9))
+
+	// balance and registration are checked before the robot is ready
+	if reasons := h.NotReady(start); len(reasons) != 2 {
+		t.Fatal("ready before the relayer was checked", reasons)
+	}
+	h.setBalance(reserve)
+	h.setRegistered(true)
+	if reasons := h.NotReady(start.Add(time.Second)); len(reasons) != 0 {
+		t.Fatal("not ready", reasons)
+	}
+
+	timeout := params.ReadyVoteTimeout
+	later := start.Add(3 * timeout)
+	tests := []struct {
+		update func()
+		now    time.Time
+		reason string
+	}{
+		{func() { h.finalizedReceived(5, start.Add(timeout)) }, start.Add(timeout + time.Second), "no vote"},
+		{func() { h.voteReceived(later) }, later, "finalized head stuck"},
+		{func() { h.finalizedReceived(10, later) }, later, ""},
+		{func() { h.setBalance(new(big.Int).Sub(reserve, big.NewInt(1))) }, later, "below the gas reserve"},
+		{func() { h.setBalance(reserve); h.setRegistered(false) }, later, "not registered"},
+	}
+	for i, test := range tests {
+		test.update()
+		reasons := h.NotReady(test.now)
+		if test.reason == "" {
+			if len(reasons) != 0 {
+				t.Errorf("test %d: not ready: %v", i, reasons)
+			}
+		} else if len(reasons) != 1 || !strings.Contains(reasons[0], test.reason) {
+			t.Errorf("test %d: reasons %v, want %q", i, reasons, test.reason)
+		}
+	}
+
+	// a finalized header that does not advance the head does not count
+	h.finalizedReceived(10, start.Add(10*params.ReadyFinalizedTimeout))
+	if reasons := h.NotReady(start.Add(10 * params.ReadyFinalizedTimeout)); len(reasons) == 0 {
+		t.Error("ready with the finalized head stuck")
+	}
+}
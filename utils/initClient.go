@@ -2,53 +2,33 @@ package utils
 
 import (
 	"fmt"
-	"log"
 	"reflect"
-	"slash-robot/params"
 	"unsafe"
 
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
-var (
-	bscTestnet = params.BSCTestnet
-	bsc        = params.BSC
-	gethWS     = params.GethWS
-	gethIpc    = params.GethIpc
-)
-
-func GetCurrentClient(clientEntered string) *ethclient.Client {
-	var clientType string
-	switch clientEntered {
-	case "bsc_testnet":
-		clientType = bscTestnet
-	case "bsc":
-		clientType = bsc
-	case "geth_ipc":
-		clientType = gethIpc
-	default:
-		clientType = gethWS
-	}
-
-	client, err := ethclient.Dial(clientType)
-
+// GetCurrentClient connects to the first healthy endpoint of clientEntered,
+// see ParseEndpoints. The connections to the other endpoints are closed.
+func GetCurrentClient(clientEntered string) (*ethclient.Client, error) {
+	clients, err := NewClientPool(ParseEndpoints(clientEntered))
 	if err != nil {
-		fmt.Println("Error connecting to client", clientType)
-		log.Fatalln(err)
-	} else {
-		fmt.Println("Successfully connected to ", clientType)
+		return nil, fmt.Errorf("error connecting to client %s: %v", clientEntered, err)
 	}
-
-	return client
+	return clients.take(), nil
 }
 
-func InitRPCClient(_ClientEntered string) *rpc.Client {
+func InitRPCClient(_ClientEntered string) (*rpc.Client, error) {
 	clientEntered := _ClientEntered
+	client, err := GetCurrentClient(clientEntered)
+	if err != nil {
+		return nil, err
+	}
 	var clientValue reflect.Value
-	clientValue = reflect.ValueOf(GetCurrentClient(clientEntered)).Elem()
+	clientValue = reflect.ValueOf(client).Elem()
 	fieldStruct := clientValue.FieldByName("c")
 	clientPointer := reflect.NewAt(fieldStruct.Type(), unsafe.Pointer(fieldStruct.UnsafeAddr())).Elem()
 	finalClient, _ := clientPointer.Interface().(*rpc.Client)
-	return finalClient
+	return finalClient, nil
 }
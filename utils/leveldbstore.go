@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/leveldb"
+)
+
+// Key layout of LevelDBVoteStore:
+//
+//	voteKeyPrefix   + vote address + target (big endian) -> JSON StoredVote
+//	targetKeyPrefix + target (big endian) + vote address -> empty
+//
+// The second index lets PruneBelow walk votes in target order without
+// visiting every validator.
+var (
+	voteKeyPrefix   = []byte("v")
+	targetKeyPrefix = []byte("t")
+)
+
+const (
+	levelDBCache   = 16
+	levelDBHandles = 16
+)
+
+// LevelDBVoteStore is a VoteStore kept in an embedded LevelDB, so the history
+// does not need to fit in memory.
+type LevelDBVoteStore struct {
+	db *leveldb.Database
+}
+
+func NewLevelDBVoteStore(dir string) (*LevelDBVoteStore, error) {
+	db, err := leveldb.New(dir, levelDBCache, levelDBHandles, "slashrobot/votes/", false)
+	if err != nil {
+		return nil, err
+	}
+	return &LevelDBVoteStore{db: db}, nil
+}
+
+func encodeTarget(target uint64) []byte {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, target)
+	return enc
+}
+
+func voteKey(voteAddr types.BLSPublicKey, target uint64) []byte {
+	key := append(append([]byte{}, voteKeyPrefix...), voteAddr.Bytes()...)
+	return append(key, encodeTarget(target)...)
+}
+
+func targetKey(target uint64, voteAddr types.BLSPublicKey) []byte {
+	key := append(append([]byte{}, targetKeyPrefix...), encodeTarget(target)...)
+	return append(key, voteAddr.Bytes()...)
+}
+
+func (s *LevelDBVoteStore) Put(validator common.Address, vote *types.VoteEnvelope) error {
+	return s.put(vote.VoteAddress, &StoredVote{Height: vote.Data.TargetNumber, Vote: vote, Validator: validator})
+}
+
+func (s *LevelDBVoteStore) put(voteAddr types.BLSPublicKey, r *StoredVote) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	batch := s.db.NewBatch()
+	if err := batch.Put(voteKey(voteAddr, r.Height), data); err != nil {
+		return err
+	}
+	if err := batch.Put(targetKey(r.Height, voteAddr), nil); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// importLegacyVoteFiles moves the votes of the files written by the old
+// shutdown code in dir into the store, as NewVotesRecordStore does. Votes
+// already stored win, as they are newer.
+func (s *LevelDBVoteStore) importLegacyVoteFiles(dir string) error {
+	legacy, err := legacyVoteFiles(dir)
+	if err != nil {
+		return err
+	}
+	for _, filePath := range legacy {
+		records, err := readLegacyVoteFile(filePath)
+		if err != nil {
+			return fmt.Errorf("%s: %v", filePath, err)
+		}
+		voteAddr := newBLSPubKey(path.Base(filePath))
+		for _, r := range records {
+			if ok, err := s.db.Has(voteKey(voteAddr, r.Height)); err != nil {
+				return err
+			} else if ok {
+				continue
+			}
+			if err := s.put(voteAddr, r); err != nil {
+				return err
+			}
+		}
+		if err := os.Remove(filePath); err != nil {
+			return fmt.Errorf("remove legacy file: %v", err)
+		}
+		storeLog.Info("Migrated legacy vote file", "file", filePath)
+	}
+	return nil
+}
+
+func (s *LevelDBVoteStore) Get(voteAddr types.BLSPublicKey, target uint64) (*StoredVote, error) {
+	key := voteKey(voteAddr, target)
+	if ok, err := s.db.Has(key); err != nil || !ok {
+		return nil, err
+	}
+	data, err := s.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	vote := new(StoredVote)
+	if err := json.Unmarshal(data, vote); err != nil {
+		return nil, err
+	}
+	return vote, nil
+}
+
+func (s *LevelDBVoteStore) RangeByTarget(voteAddr types.BLSPublicKey, from, to uint64, fn func(*StoredVote) bool) error {
+	prefix := append(append([]byte{}, voteKeyPrefix...), voteAddr.Bytes()...)
+	it := s.db.NewIterator(prefix, encodeTarget(from))
+	defer it.Release()
+	for it.Next() {
+		if binary.BigEndian.Uint64(it.Key()[len(prefix):]) > to {
+			break
+		}
+		vote := new(StoredVote)
+		if err := json.Unmarshal(it.Value(), vote); err != nil {
+			return err
+		}
+		if !fn(vote) {
+			break
+		}
+	}
+	return it.Error()
+}
+
+func (s *LevelDBVoteStore) PruneBelow(height uint64) (int, error) {
+	it := s.db.NewIterator(targetKeyPrefix, nil)
+	defer it.Release()
+	batch := s.db.NewBatch()
+	var pruned int
+	for it.Next() {
+		key := it.Key()[len(targetKeyPrefix):]
+		target := binary.BigEndian.Uint64(key[:8])
+		if target >= height {
+			break
+		}
+		var voteAddr types.BLSPublicKey
+		copy(voteAddr[:], key[8:])
+		if err := batch.Delete(voteKey(voteAddr, target)); err != nil {
+			return pruned, err
+		}
+		if err := batch.Delete(it.Key()); err != nil {
+			return pruned, err
+		}
+		pruned++
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return pruned, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return pruned, err
+	}
+	return pruned, batch.Write()
+}
+
+// Len counts the keys of the target index, which holds one per vote.
+func (s *LevelDBVoteStore) Len() (int, error) {
+	it := s.db.NewIterator(targetKeyPrefix, nil)
+	defer it.Release()
+	var n int
+	for it.Next() {
+		n++
+	}
+	return n, it.Error()
+}
+
+func (s *LevelDBVoteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Loggers of the components, which tag every line with a component field.
+var (
+	detectorLog     = Logger("detector")
+	storeLog        = Logger("store")
+	submitterLog    = Logger("submitter")
+	subscriptionLog = Logger("subscription")
+	endpointLog     = Logger("endpoint")
+	backfillLog     = Logger("backfill")
+	relayerLog      = Logger("relayer")
+	statusLog       = Logger("status")
+	notifyLog       = Logger("notify")
+)
+
+// Logger returns the logger of component, which tags every line with it.
+func Logger(component string) log.Logger {
+	return log.New("component", component)
+}
+
+// SetupLogging writes the logs of level and above to w, in format logfmt,
+// json or terminal.
+func SetupLogging(w io.Writer, format, level string) error {
+	lvl, err := log.LvlFromString(level)
+	if err != nil {
+		return err
+	}
+	var fmtr log.Format
+	switch format {
+	case "logfmt":
+		fmtr = log.LogfmtFormat()
+	case "json":
+		fmtr = log.JSONFormat()
+	case "terminal":
+		fmtr = log.TerminalFormat(false)
+	default:
+		return fmt.Errorf("unknown log format %q, use logfmt, json or terminal", format)
+	}
+	log.Root().SetHandler(log.LvlFilterHandler(lvl, log.StreamHandler(w, fmtr)))
+	return nil
+}
+
+// violationCtx is the context of every log line about a pair of conflicting
+// votes: the validator, both votes' heights and the id of their evidence.
+func violationCtx(typ ViolationType, validator common.Address, vote, conflict *types.VoteEnvelope) []interface{} {
+	return []interface{}{
+		"type", typ.String(),
+		"validator", validator.Hex(),
+		"vote_address", common.Bytes2Hex(vote.VoteAddress.Bytes()),
+		"source", vote.Data.SourceNumber,
+		"target", vote.Data.TargetNumber,
+		"conflict_source", conflict.Data.SourceNumber,
+		"conflict_target", conflict.Data.TargetNumber,
+		"evidence", EvidenceID(vote, conflict).Hex(),
+	}
+}
+
+// LogCtx returns the context to log the violation with.
+func (v *Violation) LogCtx() []interface{} {
+	return violationCtx(v.Type, v.Validator, v.Vote, v.Conflict)
+}
+
+// LogCtx returns the context to log the evidence with.
+func (e *Evidence) LogCtx() []interface{} {
+	return violationCtx(e.Type, e.Validator, e.VoteA, e.VoteB)
+}
+
+// LogLimiter lets limit lines per minute through, so that a flood of bad
+// input cannot flood the logs. It is not safe for concurrent use.
+type LogLimiter struct {
+	limiter    rateLimiter
+	suppressed uint64
+}
+
+func NewLogLimiter(limit uint64) *LogLimiter {
+	return &LogLimiter{limiter: rateLimiter{limit: limit}}
+}
+
+// Allow reports whether a line may be logged now and, if so, how many were
+// suppressed since the last one let through.
+func (l *LogLimiter) Allow() (bool, uint64) {
+	if !l.limiter.allow(time.Now()) {
+		l.suppressed++
+		return false, 0
+	}
+	suppressed := l.suppressed
+	l.suppressed = 0
+	return true, suppressed
+}
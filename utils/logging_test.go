@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+func TestViolationLog(t *testing.T) {
+	var buf bytes.Buffer
+	if err := SetupLogging(&buf, "json", "info"); err != nil {
+		t.Fatal(err)
+	}
+	defer log.Root().SetHandler(log.DiscardHandler())
+
+	vote, conflict := newTestVote(walTestVoteAddr, 9, 12), newTestVote(walTestVoteAddr, 10, 11)
+	detected(&Violation{Type: SurroundingVote, Validator: testValidator, Vote: vote, Conflict: conflict})
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err, buf.String())
+	}
+	want := map[string]interface{}{
+		"lvl":             "warn",
+		"component":       "detector",
+		"type":            "surrounding vote",
+		"validator":       testValidator.Hex(),
+		"vote_address":    walTestVoteAddr,
+		"source":          float64(9),
+		"target":          float64(12),
+		"conflict_source": float64(10),
+		"conflict_target": float64(11),
+		"evidence":        EvidenceID(vote, conflict).Hex(),
+	}
+	for k, v := range want {
+		if line[k] != v {
+			t.Errorf("%s = %v, want %v", k, line[k], v)
+		}
+	}
+}
+
+func TestSetupLoggingInvalid(t *testing.T) {
+	if err := SetupLogging(&bytes.Buffer{}, "xml", "info"); err == nil {
+		t.Error("unknown format accepted")
+	}
+	if err := SetupLogging(&bytes.Buffer{}, "json", "loud"); err == nil {
+		t.Error("unknown level accepted")
+	}
+}
+
+func TestLogLimiter(t *testing.T) {
+	limiter := NewLogLimiter(2)
+	for i := 0; i < 2; i++ {
+		if ok, suppressed := limiter.Allow(); !ok || suppressed != 0 {
+			t.Fatal("line", i, "suppressed")
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.Allow(); ok {
+			t.Fatal("line over the limit let through")
+		}
+	}
+	// a minute later the suppressed lines are reported with the next one
+	limiter.limiter.start = limiter.limiter.start.Add(-time.Minute)
+	if ok, suppressed := limiter.Allow(); !ok || suppressed != 3 {
+		t.Error("after a minute", ok, suppressed)
+	}
+}
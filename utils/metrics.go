@@ -0,0 +1,277 @@
+package utils
+
+import (
+	"context"
+	"math/big"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "slash_robot"
+
+var (
+	prunePassesCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "store",
+		Name:      "prune_passes_total",
+		Help:      "Number of vote history pruning passes.",
+	})
+	prunedVotesCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "store",
+		Name:      "pruned_votes_total",
+		Help:      "Number of votes deleted from the vote history by pruning.",
+	})
+	pruneHeightGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "store",
+		Name:      "prune_height",
+		Help:      "Target height below which the vote history was last pruned.",
+	})
+	pruneDurationHistogram = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "store",
+		Name:      "prune_duration_seconds",
+		Help:      "Duration of a vote history pruning pass.",
+	})
+	storeVotesGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "store",
+		Name:      "votes",
+		Help:      "Number of votes in the vote history after the last pruning pass.",
+	})
+	votesReceivedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "votes",
+		Name:      "received_total",
+		Help:      "Number of verified votes received from validators of the validator set, by validator.",
+	}, []string{"validator"})
+	voteLastReceivedGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "votes",
+		Name:      "last_received_timestamp_seconds",
+		Help:      "Unix time the last vote was received.",
+	})
+	voteFeedLagGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "votes",
+		Name:      "feed_lag_blocks",
+		Help:      "Blocks between the chain head and the highest target of the votes received.",
+	})
+	violationsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "votes",
+		Name:      "violations_total",
+		Help:      "Number of slashable vote pairs detected, by violation type.",
+	}, []string{"type"})
+	invalidVotesCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "votes",
+		Name:      "invalid_total",
+		Help:      "Number of votes dropped by verification, by reason.",
+	}, []string{"reason"})
+	unknownVotesCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "votes",
+		Name:      "unknown_validator_total",
+		Help:      "Number of votes dropped because the vote address is not in the validator set.",
+	})
+	evidenceSubmittedCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "evidence",
+		Name:      "submitted_total",
+		Help:      "Number of evidence transactions sent to SlashIndicator.",
+	})
+	evidenceIncludedCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "evidence",
+		Name:      "included_total",
+		Help:      "Number of evidence transactions mined with the validator slashed.",
+	})
+	evidenceOutcomeCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "evidence",
+		Name:      "outcome_total",
+		Help:      "Number of evidence that reached a final outcome, by outcome.",
+	}, []string{"outcome"})
+	evidenceReorgedCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "evidence",
+		Name:      "reorged_total",
+		Help:      "Number of evidence transactions dropped from the chain by a reorg.",
+	})
+	backfilledBlocksCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "backfill",
+		Name:      "blocks_total",
+		Help:      "Number of finalized blocks whose attestation was backfilled.",
+	})
+	endpointHealthyGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "endpoint",
+		Name:      "healthy",
+		Help:      "Whether the endpoint passed its last health check, by endpoint.",
+	}, []string{"endpoint"})
+	endpointFailoversCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "endpoint",
+		Name:      "failovers_total",
+		Help:      "Number of switches to another endpoint.",
+	})
+	subscriptionFailuresCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "subscription",
+		Name:      "failures_total",
+		Help:      "Number of subscriptions that failed or stalled, by subscription.",
+	}, []string{"subscription"})
+	subscriptionReconnectsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "subscription",
+		Name:      "reconnects_total",
+		Help:      "Number of subscriptions restored after a failure or stall, by subscription.",
+	}, []string{"subscription"})
+	subscriptionGapHistogram = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "subscription",
+		Name:      "gap_seconds",
+		Help:      "Time without notifications before a subscription was restored, by subscription.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"subscription"})
+	validatorSetSizeGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "validators",
+		Name:      "count",
+		Help:      "Number of validators in the current validator set.",
+	})
+	chainHeadGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "chain",
+		Name:      "head",
+		Help:      "Number of the latest head received.",
+	})
+	finalizedLagGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "chain",
+		Name:      "finalized_lag_blocks",
+		Help:      "Blocks between the chain head and the latest finalized header received.",
+	})
+	relayerBalanceGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "relayer",
+		Name:      "balance_bnb",
+		Help:      "Balance of the relayer account paying for evidence transactions.",
+	})
+	notificationsSentCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "notify",
+		Name:      "sent_total",
+		Help:      "Number of notifications posted, by webhook and event.",
+	}, []string{"webhook", "event"})
+	notificationsDroppedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "notify",
+		Name:      "dropped_total",
+		Help:      "Number of notifications not posted, by webhook and reason: queue_full, rate_limited, template or failed.",
+	}, []string{"webhook", "reason"})
+)
+
+// heights holds the latest head, finalized height and vote target seen, from
+// which the lags are derived.
+var heights struct {
+	sync.Mutex
+	head, finalized, voteTarget uint64
+}
+
+// ObserveHead records a new chain head.
+func ObserveHead(header *types.Header) {
+	heights.Lock()
+	defer heights.Unlock()
+	heights.head = header.Number.Uint64()
+	chainHeadGauge.Set(float64(heights.head))
+	updateLagsLocked()
+}
+
+// ObserveFinalized records a new finalized header.
+func ObserveFinalized(header *types.Header) {
+	heights.Lock()
+	defer heights.Unlock()
+	heights.finalized = header.Number.Uint64()
+	updateLagsLocked()
+	health.finalizedReceived(heights.finalized, time.Now())
+}
+
+// ObserveVote records a verified vote of validator, a validator set member,
+// received from the vote feed.
+func ObserveVote(vote *types.VoteEnvelope, validator common.Address) {
+	votesReceivedCounter.WithLabelValues(validator.Hex()).Inc()
+	voteLastReceivedGauge.SetToCurrentTime()
+	health.voteReceived(time.Now())
+	heights.Lock()
+	defer heights.Unlock()
+	if vote.Data.TargetNumber > heights.voteTarget {
+		heights.voteTarget = vote.Data.TargetNumber
+		updateLagsLocked()
+	}
+}
+
+func updateLagsLocked() {
+	lag := func(height uint64) float64 {
+		if height == 0 || height > heights.head {
+			return 0
+		}
+		return float64(heights.head - height)
+	}
+	voteFeedLagGauge.Set(lag(heights.voteTarget))
+	finalizedLagGauge.Set(lag(heights.finalized))
+}
+
+// UpdateRelayerBalance reads the balance of account for the metrics.
+func UpdateRelayerBalance(client *ethclient.Client, account common.Address) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	balance, err := client.BalanceAt(ctx, account, nil)
+	if err != nil {
+		return err
+	}
+	bnb, _ := new(big.Float).Quo(new(big.Float).SetInt(balance), big.NewFloat(1e18)).Float64()
+	relayerBalanceGauge.Set(bnb)
+	health.setBalance(balance)
+	return nil
+}
+
+// ServeStatus serves the metrics at /metrics, liveness at /healthz and
+// readiness at /readyz on addr until ctx is done. It returns the address
+// listened on once listening, so a port in use fails the start.
+func ServeStatus(ctx context.Context, addr string) (net.Addr, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", healthz)
+	mux.HandleFunc("/readyz", readyz)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != http.ErrServerClosed {
+			statusLog.Error("Status server failed", "err", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	statusLog.Info("Serving metrics and health", "addr", listener.Addr().String())
+	return listener.Addr(), nil
+}
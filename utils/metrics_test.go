@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveLags(t *testing.T) {
+	header := func(number int64) *types.Header { return &types.Header{Number: big.NewInt(number)} }
+	ObserveHead(header(100))
+	ObserveFinalized(header(97))
+	received := testutil.ToFloat64(votesReceivedCounter.WithLabelValues(testValidator.Hex()))
+	ObserveVote(newTestVote(walTestVoteAddr, 98, 99), testValidator)
+	if got := testutil.ToFloat64(votesReceivedCounter.WithLabelValues(testValidator.Hex())); got != received+1 {
+		t.Error("votes received", got-received)
+	}
+	if lag := testutil.ToFloat64(voteFeedLagGauge); lag != 1 {
+		t.Error("vote feed lag", lag)
+	}
+	if lag := testutil.ToFloat64(finalizedLagGauge); lag != 3 {
+		t.Error("finalized lag", lag)
+	}
+	// the lags grow while only heads arrive
+	ObserveHead(header(110))
+	if lag := testutil.ToFloat64(voteFeedLagGauge); lag != 11 {
+		t.Error("vote feed lag after heads", lag)
+	}
+	if lag := testutil.ToFloat64(finalizedLagGauge); lag != 13 {
+		t.Error("finalized lag after heads", lag)
+	}
+}
+
+func TestServeStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, err := ServeStatus(ctx, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ObserveHead(&types.Header{Number: big.NewInt(42)})
+	resp, err := http.Get("http://" + addr.String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "slash_robot_chain_head 42") {
+		t.Error("chain head not exported")
+	}
+	for path, status := range map[string]int{"/healthz": http.StatusOK, "/readyz": http.StatusServiceUnavailable} {
+		resp, err := http.Get("http://" + addr.String() + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("%s: status %d, want %d", path, resp.StatusCode, status)
+		}
+	}
+	if _, err := ServeStatus(ctx, addr.String()); err == nil {
+		t.Error("port in use accepted")
+	}
+}
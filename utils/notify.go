@@ -0,0 +1,416 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slash-robot/params"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+type NotifyEvent string
+
+const (
+	EventViolationDetected NotifyEvent = "violation_detected"
+	EventEvidenceSubmitted NotifyEvent = "evidence_submitted"
+	EventEvidenceFailed    NotifyEvent = "evidence_failed"
+	EventMonitoringGap     NotifyEvent = "monitoring_gap"
+)
+
+// defaultTemplate renders the summary followed by the details, in key order.
+const defaultTemplate = `[{{.Severity}}] {{.Summary}}{{range $key, $value := .Details}} {{$key}}={{$value}}{{end}}`
+
+// notifyQueueSize is the number of notifications waiting to be posted, beyond
+// which new ones are dropped.
+const notifyQueueSize = 64
+
+// Notification is an alert. Webhook templates are executed with it, e.g.
+// {{.Summary}} or {{.Details.validator}}; the details are the fields logged
+// with the event.
+type Notification struct {
+	Event    NotifyEvent
+	Severity Severity
+	Time     time.Time
+	Summary  string
+	Details  map[string]interface{}
+	// Resolved marks the end of the incident an earlier notification of the
+	// same event and key was about.
+	Resolved bool
+}
+
+func newNotification(event NotifyEvent, severity Severity, summary string, ctx ...interface{}) *Notification {
+	details := map[string]interface{}{"network": params.Network}
+	for i := 0; i+1 < len(ctx); i += 2 {
+		details[fmt.Sprint(ctx[i])] = ctx[i+1]
+	}
+	return &Notification{Event: event, Severity: severity, Time: time.Now(), Summary: summary, Details: details}
+}
+
+// key identifies the incident n is about, so that alerting tools can group
+// the notifications of the same evidence or subscription.
+func (n *Notification) key() string {
+	for _, field := range []string{"evidence", "subscription"} {
+		if value, ok := n.Details[field]; ok {
+			return fmt.Sprintf("%s/%v", n.Event, value)
+		}
+	}
+	return string(n.Event)
+}
+
+// Notifier posts notifications to the webhooks their severity is routed to,
+// in the background, so that detection and submission never wait on them. A
+// nil Notifier drops every notification.
+type Notifier struct {
+	webhooks []*webhook
+	client   *http.Client
+	queue    chan *Notification
+}
+
+// NewNotifier returns a notifier posting to hooks. Their templates are parsed
+// right away, so that a broken one fails the start.
+func NewNotifier(hooks []params.Webhook) (*Notifier, error) {
+	n := &Notifier{
+		client: &http.Client{Timeout: params.NotifyTimeout},
+		queue:  make(chan *Notification, notifyQueueSize),
+	}
+	for i, hook := range hooks {
+		w, err := newWebhook(i, hook)
+		if err != nil {
+			return nil, err
+		}
+		n.webhooks = append(n.webhooks, w)
+	}
+	return n, nil
+}
+
+// Notify queues notification for posting. It is dropped if the queue is full.
+func (n *Notifier) Notify(notification *Notification) {
+	if n == nil || len(n.webhooks) == 0 {
+		return
+	}
+	select {
+	case n.queue <- notification:
+	default:
+		notificationsDroppedCounter.WithLabelValues("all", "queue_full").Inc()
+		notifyLog.Warn("Notification queue full, dropping notification", "event", notification.Event, "summary", notification.Summary)
+	}
+}
+
+// Violation notifies that violation was detected.
+func (n *Notifier) Violation(violation *Violation) {
+	summary := fmt.Sprintf("Validator %s cast a %s", violation.Validator.Hex(), violation.Type)
+	n.Notify(newNotification(EventViolationDetected, SeverityCritical, summary, violation.LogCtx()...))
+}
+
+// EvidenceSubmitted notifies that a transaction carrying e was sent.
+func (n *Notifier) EvidenceSubmitted(e *Evidence) {
+	summary := fmt.Sprintf("Evidence against validator %s submitted in tx %s", e.Validator.Hex(), e.TxHash.Hex())
+	n.Notify(newNotification(EventEvidenceSubmitted, SeverityInfo, summary, evidenceCtx(e, "tx", e.TxHash.Hex(), "nonce", e.Nonce)...))
+}
+
+// EvidenceFailed notifies that e reached a final status without slashing the
+// validator.
+func (n *Notifier) EvidenceFailed(e *Evidence) {
+	summary := fmt.Sprintf("Evidence against validator %s %s", e.Validator.Hex(), e.Status)
+	if e.LastError != "" {
+		summary += ": " + e.LastError
+	}
+	n.Notify(newNotification(EventEvidenceFailed, SeverityCritical, summary, evidenceCtx(e, "status", string(e.Status), "err", e.LastError)...))
+}
+
+// Gap notifies that subscription has delivered nothing since lastSeen and is
+// still down. Votes cast meanwhile are not checked, unless backfilled from the
+// attestations.
+func (n *Notifier) Gap(subscription string, lastSeen time.Time) {
+	gap := time.Since(lastSeen).Round(time.Second)
+	summary := fmt.Sprintf("No notifications from %s for %s", subscription, gap)
+	n.Notify(newNotification(EventMonitoringGap, SeverityWarning, summary, "subscription", subscription, "gap", gap.String(), "last_seen", lastSeen.UTC().Format(time.RFC3339)))
+}
+
+// GapResolved notifies that subscription, reported by Gap, is back.
+func (n *Notifier) GapResolved(subscription string, lastSeen time.Time) {
+	gap := time.Since(lastSeen).Round(time.Second)
+	summary := fmt.Sprintf("Notifications from %s resumed after %s", subscription, gap)
+	notification := newNotification(EventMonitoringGap, SeverityWarning, summary, "subscription", subscription, "gap", gap.String(), "last_seen", lastSeen.UTC().Format(time.RFC3339))
+	notification.Resolved = true
+	n.Notify(notification)
+}
+
+// FeedGap reports the gaps of a feed subscribed to on several endpoints as
+// one: the feed is down while every endpoint is.
+type FeedGap struct {
+	notifier *Notifier
+	name     string
+	members  int
+
+	mu       sync.Mutex
+	down     map[int]time.Time
+	reported bool
+}
+
+// FeedGap returns the gap reporter of the feed name, subscribed to on members
+// endpoints.
+func (n *Notifier) FeedGap(name string, members int) *FeedGap {
+	return &FeedGap{notifier: n, name: name, members: members, down: make(map[int]time.Time)}
+}
+
+// Open records that the subscription of member has been down since lastSeen.
+func (g *FeedGap) Open(member int, lastSeen time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.down[member] = lastSeen
+	if g.reported || len(g.down) < g.members {
+		return
+	}
+	g.reported = true
+	g.notifier.Gap(g.name, g.lastSeenLocked())
+}
+
+// Closed records that the subscription of member is back.
+func (g *FeedGap) Closed(member int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	lastSeen := g.lastSeenLocked()
+	delete(g.down, member)
+	if g.reported {
+		g.reported = false
+		g.notifier.GapResolved(g.name, lastSeen)
+	}
+}
+
+// lastSeenLocked returns when the feed last delivered, on any endpoint.
+func (g *FeedGap) lastSeenLocked() time.Time {
+	var lastSeen time.Time
+	for _, seen := range g.down {
+		if seen.After(lastSeen) {
+			lastSeen = seen
+		}
+	}
+	return lastSeen
+}
+
+// Run posts the queued notifications until ctx is done. The ones still queued
+// then get a single attempt each. Failed posts are retried with backoff while
+// ctx is not done.
+func (n *Notifier) Run(ctx context.Context) {
+	for {
+		select {
+		case notification := <-n.queue:
+			n.deliver(ctx, notification, params.NotifyAttempts)
+		case <-ctx.Done():
+			for {
+				select {
+				case notification := <-n.queue:
+					n.deliver(ctx, notification, 1)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (n *Notifier) deliver(ctx context.Context, notification *Notification, attempts int) {
+	for _, w := range n.webhooks {
+		if !w.routes(notification.Severity) {
+			continue
+		}
+		if !w.allow(notification) {
+			notificationsDroppedCounter.WithLabelValues(w.name, "rate_limited").Inc()
+			notifyLog.Warn("Webhook rate limited, dropping notification", "webhook", w.name, "event", notification.Event, "summary", notification.Summary)
+			continue
+		}
+		body, err := w.payload(notification)
+		if err != nil {
+			notificationsDroppedCounter.WithLabelValues(w.name, "template").Inc()
+			notifyLog.Error("Failed to render notification", "webhook", w.name, "event", notification.Event, "err", err)
+			continue
+		}
+		if err := n.post(ctx, w, body, attempts); err != nil {
+			notificationsDroppedCounter.WithLabelValues(w.name, "failed").Inc()
+			notifyLog.Error("Failed to post notification", "webhook", w.name, "event", notification.Event, "summary", notification.Summary, "err", err)
+			continue
+		}
+		notificationsSentCounter.WithLabelValues(w.name, string(notification.Event)).Inc()
+	}
+}
+
+// post sends body to w, up to attempts times with backoff while ctx is not
+// done. Each attempt has params.NotifyTimeout, even after ctx is done.
+func (n *Notifier) post(ctx context.Context, w *webhook, body []byte, attempts int) error {
+	for attempt := 1; ; attempt++ {
+		err := n.postOnce(w, body)
+		if err == nil || attempt >= attempts {
+			return err
+		}
+		notifyLog.Debug("Retrying notification", "webhook", w.name, "attempt", attempt, "err", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(Backoff(attempt, time.Second, params.NotifyTimeout)):
+		}
+	}
+}
+
+func (n *Notifier) postOnce(w *webhook, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), params.NotifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// webhook is a configured params.Webhook.
+type webhook struct {
+	name       string
+	url        string
+	format     string
+	routingKey string
+	severities map[Severity]bool
+	template   *template.Template
+	limit      uint64
+	limiters   map[Severity]*rateLimiter
+}
+
+func newWebhook(i int, hook params.Webhook) (*webhook, error) {
+	w := &webhook{
+		name:       hook.Name,
+		url:        hook.URL,
+		format:     hook.Format,
+		routingKey: hook.RoutingKey,
+		severities: make(map[Severity]bool),
+		limiters:   make(map[Severity]*rateLimiter),
+	}
+	if w.name == "" {
+		w.name = fmt.Sprintf("webhook/%d", i)
+	}
+	if w.format == "" {
+		w.format = "slack"
+	}
+	for _, severity := range hook.Severities {
+		w.severities[Severity(severity)] = true
+	}
+	text := hook.Template
+	if text == "" {
+		text = defaultTemplate
+	}
+	tmpl, err := template.New(w.name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("webhook %s: %v", w.name, err)
+	}
+	w.template = tmpl
+	w.limit = hook.RateLimit
+	if w.limit == 0 {
+		w.limit = params.NotifyRateLimit
+	}
+	return w, nil
+}
+
+// allow reports whether notification is within the rate limit of w. Each
+// severity has its own budget, so a burst of warnings cannot crowd out a
+// critical alert. Resolves are always sent, they close an incident that was
+// already alerted.
+func (w *webhook) allow(notification *Notification) bool {
+	if notification.Resolved {
+		return true
+	}
+	limiter, ok := w.limiters[notification.Severity]
+	if !ok {
+		limiter = &rateLimiter{limit: w.limit}
+		w.limiters[notification.Severity] = limiter
+	}
+	return limiter.allow(notification.Time)
+}
+
+// routes reports whether notifications of severity are sent to w.
+func (w *webhook) routes(severity Severity) bool {
+	return len(w.severities) == 0 || w.severities[severity]
+}
+
+// payload renders notification in the format of w.
+func (w *webhook) payload(notification *Notification) ([]byte, error) {
+	var text strings.Builder
+	if err := w.template.Execute(&text, notification); err != nil {
+		return nil, err
+	}
+	switch w.format {
+	case "pagerduty":
+		summary := text.String()
+		// PagerDuty refuses longer summaries
+		if len(summary) > 1024 {
+			summary = summary[:1024]
+		}
+		action := "trigger"
+		if notification.Resolved {
+			action = "resolve"
+		}
+		return json.Marshal(map[string]interface{}{
+			"routing_key":  w.routingKey,
+			"event_action": action,
+			"dedup_key":    notification.key(),
+			"payload": map[string]interface{}{
+				"summary":        summary,
+				"source":         "slash-robot",
+				"severity":       string(notification.Severity),
+				"timestamp":      notification.Time.UTC().Format(time.RFC3339),
+				"component":      string(notification.Event),
+				"custom_details": notification.Details,
+			},
+		})
+	case "json":
+		return json.Marshal(map[string]interface{}{
+			"event":    notification.Event,
+			"resolved": notification.Resolved,
+			"severity": notification.Severity,
+			"time":     notification.Time.UTC().Format(time.RFC3339),
+			"message":  text.String(),
+			"details":  notification.Details,
+		})
+	default:
+		return json.Marshal(map[string]string{"text": text.String()})
+	}
+}
+
+// rateLimiter allows limit notifications per minute. It is only used by the
+// goroutine running the Notifier.
+type rateLimiter struct {
+	limit  uint64
+	start  time.Time
+	posted uint64
+}
+
+func (l *rateLimiter) allow(now time.Time) bool {
+	if now.Sub(l.start) >= time.Minute {
+		l.start = now
+		l.posted = 0
+	}
+	if l.posted >= l.limit {
+		return false
+	}
+	l.posted++
+	return true
+}
@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"slash-robot/params"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookStub records the bodies posted to it by path, failing the first
+// failures posts.
+type webhookStub struct {
+	*httptest.Server
+	mu       sync.Mutex
+	bodies   map[string][]string
+	failures int
+}
+
+func newWebhookStub(t *testing.T) *webhookStub {
+	stub := &webhookStub{bodies: make(map[string][]string)}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		if stub.failures > 0 {
+			stub.failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		stub.bodies[r.URL.Path] = append(stub.bodies[r.URL.Path], string(body))
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func (s *webhookStub) posted(path string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.bodies[path]...)
+}
+
+// flush posts what was notified so far and returns once done.
+func flush(n *Notifier) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	n.Run(ctx)
+}
+
+func TestNotifierRouting(t *testing.T) {
+	stub := newWebhookStub(t)
+	n, err := NewNotifier([]params.Webhook{
+		{Name: "chat", URL: stub.URL + "/slack", Template: "{{.Summary}} evidence={{.Details.evidence}}"},
+		{Name: "pager", URL: stub.URL + "/pagerduty", Format: "pagerduty", RoutingKey: "key", Severities: []string{"critical"}},
+		{Name: "archive", URL: stub.URL + "/json", Format: "json", Severities: []string{"warning"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	violation := newTestViolation(9, 12)
+	n.Violation(violation)
+	n.Gap("votes", time.Now().Add(-2*params.NotifyGapThreshold))
+	flush(n)
+
+	evidence := EvidenceID(violation.Vote, violation.Conflict).Hex()
+	chat := stub.posted("/slack")
+	if len(chat) != 2 {
+		t.Fatal("slack webhook got", chat)
+	}
+	var message struct{ Text string }
+	if err := json.Unmarshal([]byte(chat[0]), &message); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Validator " + testValidator.Hex() + " cast a double vote evidence=" + evidence; message.Text != want {
+		t.Errorf("slack text %q, want %q", message.Text, want)
+	}
+
+	pager := stub.posted("/pagerduty")
+	if len(pager) != 1 {
+		t.Fatal("critical only webhook got", pager)
+	}
+	var event struct {
+		RoutingKey  string `json:"routing_key"`
+		EventAction string `json:"event_action"`
+		DedupKey    string `json:"dedup_key"`
+		Payload     struct {
+			Severity      string
+			CustomDetails map[string]interface{} `json:"custom_details"`
+		}
+	}
+	if err := json.Unmarshal([]byte(pager[0]), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.RoutingKey != "key" || event.EventAction != "trigger" || event.Payload.Severity != "critical" {
+		t.Error("pagerduty event", pager[0])
+	}
+	if event.DedupKey != "violation_detected/"+evidence || event.Payload.CustomDetails["vote_address"] != walTestVoteAddr {
+		t.Error("pagerduty event details", pager[0])
+	}
+
+	archive := stub.posted("/json")
+	if len(archive) != 1 || !strings.Contains(archive[0], `"event":"monitoring_gap"`) || !strings.Contains(archive[0], `"subscription":"votes"`) {
+		t.Error("warning only webhook got", archive)
+	}
+}
+
+func TestNotifierRateLimit(t *testing.T) {
+	stub := newWebhookStub(t)
+	n, err := NewNotifier([]params.Webhook{{URL: stub.URL, RateLimit: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		n.Violation(newTestViolation(9, 12))
+	}
+	flush(n)
+	if posted := stub.posted("/"); len(posted) != 2 {
+		t.Fatal("rate limit of 2 posted", len(posted))
+	}
+
+	// with the warning budget used up, critical alerts and resolves still go out
+	stub = newWebhookStub(t)
+	n, err = NewNotifier([]params.Webhook{{URL: stub.URL, RateLimit: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastSeen := time.Now().Add(-time.Minute)
+	for i := 0; i < 3; i++ {
+		n.Gap("votes", lastSeen)
+	}
+	n.Violation(newTestViolation(9, 12))
+	n.GapResolved("votes", lastSeen)
+	flush(n)
+	posted := stub.posted("/")
+	if len(posted) != 4 || !strings.Contains(posted[2], "double vote") || !strings.Contains(posted[3], "resumed") {
+		t.Fatal("critical alert or resolve dropped by the warning limit", posted)
+	}
+
+	limiter := &rateLimiter{limit: 1}
+	now := time.Now()
+	if !limiter.allow(now) || limiter.allow(now.Add(59*time.Second)) || !limiter.allow(now.Add(time.Minute)) {
+		t.Error("limiter does not reset after a minute")
+	}
+}
+
+func TestNotifierRetry(t *testing.T) {
+	stub := newWebhookStub(t)
+	stub.failures = 1
+	n, err := NewNotifier([]params.Webhook{{URL: stub.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n.Run(ctx)
+	}()
+	n.Violation(newTestViolation(9, 12))
+	deadline := time.Now().Add(5 * time.Second)
+	for len(stub.posted("/")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if posted := stub.posted("/"); len(posted) != 1 {
+		t.Error("failed post not retried", posted)
+	}
+}
+
+func TestNotifierTemplate(t *testing.T) {
+	if _, err := NewNotifier([]params.Webhook{{URL: "http://localhost", Template: "{{.Summary"}}); err == nil {
+		t.Error("broken template accepted")
+	}
+	var n *Notifier
+	n.Violation(newTestViolation(9, 12))
+}
+
+func TestFeedGap(t *testing.T) {
+	stub := newWebhookStub(t)
+	n, err := NewNotifier([]params.Webhook{{URL: stub.URL, Format: "pagerduty", RoutingKey: "key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gap := n.FeedGap("votes", 2)
+	start := time.Now().Add(-time.Minute)
+	gap.Open(0, start)
+	flush(n)
+	if posted := stub.posted("/"); len(posted) != 0 {
+		t.Fatal("gap of one endpoint out of two alerted", posted)
+	}
+	gap.Open(1, start.Add(time.Second))
+	gap.Open(0, start)
+	gap.Closed(1)
+	gap.Closed(0)
+	flush(n)
+
+	posted := stub.posted("/")
+	if len(posted) != 2 {
+		t.Fatal("want a trigger and a resolve, got", posted)
+	}
+	var trigger, resolve struct {
+		EventAction string `json:"event_action"`
+		DedupKey    string `json:"dedup_key"`
+	}
+	_ = json.Unmarshal([]byte(posted[0]), &trigger)
+	_ = json.Unmarshal([]byte(posted[1]), &resolve)
+	if trigger.EventAction != "trigger" || resolve.EventAction != "resolve" || trigger.DedupKey != "monitoring_gap/votes" || resolve.DedupKey != trigger.DedupKey {
+		t.Error("gap events", posted)
+	}
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"math/big"
+	"slash-robot/abi"
+	"strings"
+
+	ethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	validatorSetABI, _ = ethabi.JSON(strings.NewReader(abi.ValidatorsetABI))
+
+	slashFilterer, _        = abi.NewSlashFilterer(SlashIndicatorAddr, nil)
+	validatorSetFilterer, _ = abi.NewValidatorsetFilterer(ValidatorSetAddr, nil)
+)
+
+// SlashOutcome is what an evidence transaction did on chain, decoded from the
+// logs of its receipt.
+type SlashOutcome struct {
+	BlockNumber uint64
+	BlockHash   common.Hash
+	// validators SlashIndicator emitted validatorSlashed for
+	Slashed []common.Address
+	// validators BSCValidatorSet took a felony fine from, and how much
+	Felonies []FelonyOutcome
+	// validators BSCValidatorSet jailed
+	Jailed []common.Address
+}
+
+type FelonyOutcome struct {
+	Validator common.Address
+	Amount    *big.Int
+}
+
+// ParseSlashOutcome decodes the slashing events in the logs of rc.
+func ParseSlashOutcome(rc *types.Receipt) (*SlashOutcome, error) {
+	outcome := &SlashOutcome{BlockNumber: rc.BlockNumber.Uint64(), BlockHash: rc.BlockHash}
+	for _, l := range rc.Logs {
+		if len(l.Topics) == 0 {
+			continue
+		}
+		switch {
+		case l.Address == SlashIndicatorAddr && l.Topics[0] == slashABI.Events["validatorSlashed"].ID:
+			event, err := slashFilterer.ParseValidatorSlashed(*l)
+			if err != nil {
+				return nil, err
+			}
+			outcome.Slashed = append(outcome.Slashed, event.Validator)
+		case l.Address == ValidatorSetAddr && l.Topics[0] == validatorSetABI.Events["validatorFelony"].ID:
+			event, err := validatorSetFilterer.ParseValidatorFelony(*l)
+			if err != nil {
+				return nil, err
+			}
+			outcome.Felonies = append(outcome.Felonies, FelonyOutcome{Validator: event.Validator, Amount: event.Amount})
+		case l.Address == ValidatorSetAddr && l.Topics[0] == validatorSetABI.Events["validatorJailed"].ID:
+			event, err := validatorSetFilterer.ParseValidatorJailed(*l)
+			if err != nil {
+				return nil, err
+			}
+			outcome.Jailed = append(outcome.Jailed, event.Validator)
+		}
+	}
+	return outcome, nil
+}
+
+// Slashes reports whether SlashIndicator slashed validator.
+func (o *SlashOutcome) Slashes(validator common.Address) bool {
+	for _, slashed := range o.Slashed {
+		if slashed == validator {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestParseSlashOutcome(t *testing.T) {
+	validator := testValidator
+	other := common.HexToAddress("0x02")
+	topic := func(addr common.Address) common.Hash { return common.BytesToHash(addr.Bytes()) }
+	rc := &types.Receipt{
+		BlockNumber: big.NewInt(100),
+		Logs: []*types.Log{
+			{Address: SlashIndicatorAddr, Topics: []common.Hash{slashABI.Events["validatorSlashed"].ID, topic(validator)}},
+			{Address: ValidatorSetAddr, Topics: []common.Hash{validatorSetABI.Events["validatorFelony"].ID, topic(validator)}, Data: common.BigToHash(big.NewInt(1e18)).Bytes()},
+			{Address: ValidatorSetAddr, Topics: []common.Hash{validatorSetABI.Events["validatorJailed"].ID, topic(validator)}},
+			// same event from another contract is ignored
+			{Address: RelayerHubAddr, Topics: []common.Hash{slashABI.Events["validatorSlashed"].ID, topic(other)}},
+		},
+	}
+	outcome, err := ParseSlashOutcome(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !outcome.Slashes(validator) || outcome.Slashes(other) || outcome.BlockNumber != 100 {
+		t.Fatal("bad slashed", outcome.Slashed)
+	}
+	if len(outcome.Felonies) != 1 || outcome.Felonies[0].Validator != validator || outcome.Felonies[0].Amount.Cmp(big.NewInt(1e18)) != 0 {
+		t.Fatal("bad felonies", outcome.Felonies)
+	}
+	if len(outcome.Jailed) != 1 || outcome.Jailed[0] != validator {
+		t.Fatal("bad jailed", outcome.Jailed)
+	}
+
+	outcome, err = ParseSlashOutcome(&types.Receipt{BlockNumber: big.NewInt(100)})
+	if err != nil || outcome.Slashes(validator) {
+		t.Fatal("slash without events", err)
+	}
+}
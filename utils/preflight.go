@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"slash-robot/abi"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	ethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var slashABI, _ = ethabi.JSON(strings.NewReader(abi.SlashABI))
+
+// EvidenceRevertError is returned when SlashIndicator would revert the
+// evidence, e.g. because it is too old or was already submitted by another
+// reporter.
+type EvidenceRevertError struct {
+	Reason string
+}
+
+func (e *EvidenceRevertError) Error() string {
+	return "evidence rejected by SlashIndicator: " + e.Reason
+}
+
+// SimulateEvidence runs submitFinalityViolationEvidence for vote1 and vote2
+// from the reporter account in an eth_call, without sending a transaction.
+func SimulateEvidence(client *ethclient.Client, from common.Address, vote1, vote2 *types.VoteEnvelope) error {
+	data, err := packEvidence(vote1, vote2)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	_, err = client.CallContract(ctx, ethereum.CallMsg{From: from, To: &SlashIndicatorAddr, Data: data}, nil)
+	if err == nil {
+		return nil
+	}
+	if reason, ok := revertReason(err); ok {
+		return &EvidenceRevertError{Reason: reason}
+	}
+	return err
+}
+
+// packEvidence returns the input of submitFinalityViolationEvidence for the
+// evidence that vote1 and vote2 conflict.
+func packEvidence(vote1, vote2 *types.VoteEnvelope) ([]byte, error) {
+	return slashABI.Pack("submitFinalityViolationEvidence", NewFinalityEvidence(vote1, vote2))
+}
+
+// revertReason extracts the decoded reason from the error of a reverted
+// call. It returns false if err is not a revert.
+func revertReason(err error) (string, bool) {
+	if !strings.Contains(strings.ToLower(err.Error()), "execution reverted") {
+		return "", false
+	}
+	if de, ok := err.(rpc.DataError); ok {
+		if data, ok := de.ErrorData().(string); ok {
+			if reason, err := ethabi.UnpackRevert(common.FromHex(data)); err == nil {
+				return reason, true
+			}
+		}
+	}
+	return err.Error(), true
+}
+
+// includedBefore returns the receipt of the earlier transaction of e that made
+// it on chain, so that evidence is never sent twice after a restart or a
+// dropped receipt.
+func includedBefore(client *ethclient.Client, e *Evidence) (*types.Receipt, error) {
+	for _, txHash := range e.TxHashes {
+		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+		rc, err := client.TransactionReceipt(ctx, txHash)
+		cancel()
+		if err == ethereum.NotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get receipt of %s: %v", txHash.Hex(), err)
+		}
+		if rc.Status == types.ReceiptStatusSuccessful {
+			return rc, nil
+		}
+	}
+	return nil, nil
+}
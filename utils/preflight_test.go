@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+type testDataError struct {
+	msg  string
+	data interface{}
+}
+
+func (e *testDataError) Error() string          { return e.msg }
+func (e *testDataError) ErrorData() interface{} { return e.data }
+
+func TestRevertReason(t *testing.T) {
+	// Error("evidence too old")
+	revert := "0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000010" +
+		"65766964656e636520746f6f206f6c6400000000000000000000000000000000"
+	tests := []struct {
+		err    error
+		reason string
+		ok     bool
+	}{
+		{&testDataError{"execution reverted: evidence too old", revert}, "evidence too old", true},
+		{&testDataError{"execution reverted", "0x"}, "execution reverted", true},
+		{errors.New("execution reverted"), "execution reverted", true},
+		{errors.New("connection refused"), "", false},
+	}
+	for i, test := range tests {
+		reason, ok := revertReason(test.err)
+		if reason != test.reason || ok != test.ok {
+			t.Errorf("test %d: have %q %v, want %q %v", i, reason, ok, test.reason, test.ok)
+		}
+	}
+}
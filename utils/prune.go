@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"time"
+)
+
+// PruneHeight returns the target height below which votes can be dropped once
+// finalized is final. margin keeps votes behind finality around, as a vote can
+// still be slashed while it is inside the evidence window of SlashIndicator.
+func PruneHeight(finalized, margin uint64) uint64 {
+	if finalized <= margin {
+		return 0
+	}
+	return finalized - margin
+}
+
+// PruneVotes drops the votes of store that have fallen more than margin blocks
+// behind the finalized height and reports the pass as metrics.
+func PruneVotes(store VoteStore, finalized, margin uint64) (int, error) {
+	height := PruneHeight(finalized, margin)
+	if height == 0 {
+		return 0, nil
+	}
+	start := time.Now()
+	pruned, err := store.PruneBelow(height)
+	pruneDurationHistogram.Observe(time.Since(start).Seconds())
+	prunePassesCounter.Inc()
+	prunedVotesCounter.Add(float64(pruned))
+	if err == nil {
+		pruneHeightGauge.Set(float64(height))
+	}
+	if size, err := store.Len(); err == nil {
+		storeVotesGauge.Set(float64(size))
+	}
+	return pruned, err
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/external"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Signer signs the transactions of the relayer account.
+type Signer interface {
+	Address() common.Address
+	SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+}
+
+// KeySigner signs with a key held in memory.
+type KeySigner struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+}
+
+func NewKeySigner(key *ecdsa.PrivateKey) *KeySigner {
+	return &KeySigner{key: key, address: crypto.PubkeyToAddress(key.PublicKey)}
+}
+
+func (s *KeySigner) Address() common.Address {
+	return s.address
+}
+
+func (s *KeySigner) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), s.key)
+}
+
+// ExternalSigner has transactions signed by a Clef compatible signer, reached
+// over IPC or HTTP, so the key never enters this process.
+type ExternalSigner struct {
+	signer  *external.ExternalSigner
+	account accounts.Account
+}
+
+// NewExternalSigner connects to the signer at endpoint, an IPC path or HTTP
+// URL, which must manage address.
+func NewExternalSigner(endpoint string, address common.Address) (*ExternalSigner, error) {
+	signer, err := external.NewExternalSigner(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("external signer %s: %v", endpoint, err)
+	}
+	return &ExternalSigner{signer: signer, account: accounts.Account{Address: address}}, nil
+}
+
+func (s *ExternalSigner) Address() common.Address {
+	return s.account.Address
+}
+
+// SignTx asks the external signer to sign tx. The signed transaction is
+// checked to be tx signed by our account, as the signer may alter it.
+func (s *ExternalSigner) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	signed, err := s.signer.SignTx(s.account, tx, chainID)
+	if err != nil {
+		return nil, err
+	}
+	if signed == nil {
+		return nil, fmt.Errorf("external signer returned no transaction")
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(chainID), signed)
+	if err != nil {
+		return nil, err
+	}
+	if from != s.account.Address {
+		return nil, fmt.Errorf("external signer signed with %s instead of %s", from.Hex(), s.account.Address.Hex())
+	}
+	if !sameTransaction(tx, signed) {
+		return nil, fmt.Errorf("external signer altered transaction %s", tx.Hash().Hex())
+	}
+	return signed, nil
+}
+
+func sameTransaction(a, b *types.Transaction) bool {
+	if (a.To() == nil) != (b.To() == nil) || (a.To() != nil && *a.To() != *b.To()) {
+		return false
+	}
+	return a.Nonce() == b.Nonce() && a.Gas() == b.Gas() && a.GasPrice().Cmp(b.GasPrice()) == 0 &&
+		a.Value().Cmp(b.Value()) == 0 && bytes.Equal(a.Data(), b.Data())
+}
+
+// TransactOpts returns the options of the contract bindings transacting as
+// signer.
+func TransactOpts(signer Signer, chainID *big.Int) *bind.TransactOpts {
+	return &bind.TransactOpts{
+		From: signer.Address(),
+		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if address != signer.Address() {
+				return nil, bind.ErrNotAuthorized
+			}
+			return signer.SignTx(tx, chainID)
+		},
+		Context: context.Background(),
+	}
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core"
+)
+
+// stubClef answers the part of the Clef API the ExternalSigner uses.
+type stubClef struct {
+	key    *ecdsa.PrivateKey
+	tamper bool
+}
+
+func (s *stubClef) Version() string {
+	return "6.1.0"
+}
+
+func (s *stubClef) List() []common.Address {
+	return []common.Address{crypto.PubkeyToAddress(s.key.PublicKey)}
+}
+
+func (s *stubClef) SignTransaction(args core.SendTxArgs) (map[string]interface{}, error) {
+	nonce := uint64(args.Nonce)
+	if s.tamper {
+		nonce++
+	}
+	to := args.To.Address()
+	tx := types.NewTransaction(nonce, to, args.Value.ToInt(), uint64(args.Gas), args.GasPrice.ToInt(), *args.Data)
+	signed, err := types.SignTx(tx, types.LatestSignerForChainID(args.ChainID.ToInt()), s.key)
+	if err != nil {
+		return nil, err
+	}
+	raw, _ := signed.MarshalBinary()
+	return map[string]interface{}{"raw": hexutil.Bytes(raw), "tx": signed}, nil
+}
+
+func TestExternalSigner(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	chainID := big.NewInt(97)
+	tx := types.NewTransaction(7, common.HexToAddress("0x0000000000000000000000000000000000001001"), new(big.Int), 100000, big.NewInt(5e9), []byte{1, 2, 3})
+
+	tests := []struct {
+		clef *stubClef
+		ok   bool
+	}{
+		{&stubClef{key: key}, true},
+		{&stubClef{key: key, tamper: true}, false},
+		{&stubClef{key: other}, false},
+	}
+	for i, test := range tests {
+		server := rpc.NewServer()
+		if err := server.RegisterName("account", test.clef); err != nil {
+			t.Fatal(err)
+		}
+		httpServer := httptest.NewServer(server)
+		signer, err := NewExternalSigner(httpServer.URL, address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signed, err := signer.SignTx(tx, chainID)
+		if test.ok {
+			if err != nil {
+				t.Errorf("test %d: %v", i, err)
+			} else if from, _ := types.Sender(types.LatestSignerForChainID(chainID), signed); from != address {
+				t.Errorf("test %d: signed by %s", i, from.Hex())
+			}
+		} else if err == nil {
+			t.Errorf("test %d: bad signature accepted", i)
+		}
+		httpServer.Close()
+		server.Stop()
+	}
+}
+
+func TestTransactOpts(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := NewKeySigner(key)
+	ops := TransactOpts(signer, big.NewInt(97))
+	tx := types.NewTransaction(0, common.Address{}, new(big.Int), 21000, big.NewInt(5e9), nil)
+	if _, err := ops.Signer(signer.Address(), tx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ops.Signer(common.Address{1}, tx); err != bind.ErrNotAuthorized {
+		t.Fatal("signed for another account", err)
+	}
+}
@@ -0,0 +1,504 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slash-robot/params"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	rpcTimeout        = 10 * time.Second
+	drainPollInterval = time.Second
+)
+
+// permanentSubmitErrors are the errors that no retry of the same evidence can
+// fix. Everything else, e.g. a dropped connection or a full transaction pool,
+// is retried with backoff.
+var permanentSubmitErrors = []string{
+	"execution reverted",
+	"invalid sender",
+	"exceeds block gas limit",
+}
+
+// IsRetriableSubmitError reports whether submitting evidence again may succeed
+// after err.
+func IsRetriableSubmitError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, permanent := range permanentSubmitErrors {
+		if strings.Contains(msg, permanent) {
+			return false
+		}
+	}
+	return true
+}
+
+// SubmitBackoff returns how long to wait before the next attempt after the
+// given number of failed attempts.
+func SubmitBackoff(attempts int) time.Duration {
+	return Backoff(attempts, params.SubmitBackoffMin, params.SubmitBackoffMax)
+}
+
+// chainBackend is the part of ethclient.Client the Submitter follows its
+// transactions with.
+type chainBackend interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// Submitter drains an EvidenceQueue: it submits every piece of evidence to
+// SlashIndicator, retrying failures with backoff, until it reaches a final
+// outcome. Transactions go out through a TxSender, so evidence against several
+// validators is in flight at once.
+type Submitter struct {
+	clients *ClientPool
+	chain   chainBackend
+	queue   *EvidenceQueue
+	sender  *TxSender
+	// Notifier, if set, is told about submitted and failed evidence.
+	Notifier *Notifier
+
+	finalized uint64 // atomic
+}
+
+func NewSubmitter(clients *ClientPool, queue *EvidenceQueue, sender *TxSender) *Submitter {
+	return &Submitter{clients: clients, chain: clients, queue: queue, sender: sender}
+}
+
+// Finalized tells the submitter about a new finalized header. Included
+// evidence is settled once its block is finalized.
+func (s *Submitter) Finalized(header *types.Header) {
+	atomic.StoreUint64(&s.finalized, header.Number.Uint64())
+}
+
+// Run submits and follows the queued evidence until ctx is done. A round in
+// progress is finished first, then the receipts of the transactions in flight
+// are awaited for up to params.ShutdownTimeout.
+func (s *Submitter) Run(ctx context.Context) {
+	ticker := time.NewTicker(params.SubmitPollInterval)
+	defer ticker.Stop()
+	for {
+		s.process()
+		select {
+		case <-ctx.Done():
+			s.drain()
+			return
+		case <-ticker.C:
+		case <-s.queue.Notify():
+		}
+	}
+}
+
+// drain waits for the receipts of submitted evidence, so its outcome is on
+// disk when the robot stops. Nothing new is sent.
+func (s *Submitter) drain() {
+	deadline := time.Now().Add(params.ShutdownTimeout)
+	for {
+		submitted := s.queue.Items(func(e *Evidence) bool { return e.Status == EvidenceSubmitted })
+		if len(submitted) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			submitterLog.Warn("Stopping with evidence transactions not mined", "count", len(submitted))
+			return
+		}
+		for _, e := range submitted {
+			if _, err := s.findReceipt(e); err != nil {
+				submitterLog.Warn("Failed to get receipt", evidenceCtx(e, "tx", e.TxHash.Hex(), "err", err)...)
+			}
+		}
+		time.Sleep(drainPollInterval)
+	}
+}
+
+func (s *Submitter) process() {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	head, err := s.clients.Client().BlockNumber(ctx)
+	cancel()
+	if err != nil {
+		submitterLog.Warn("Failed to get head", "err", err)
+		return
+	}
+	items := s.queue.Items(func(e *Evidence) bool { return !e.Status.Final() })
+	var inflight int
+	// evidence against a validator is submitted one at a time, oldest first,
+	// so that superseded sees the settled outcome of the previous one
+	busy := make(map[types.BLSPublicKey]bool)
+	for _, e := range items {
+		switch e.Status {
+		case EvidenceSubmitted:
+			inflight++
+			busy[e.VoteA.VoteAddress] = true
+		case EvidenceIncluded:
+			busy[e.VoteA.VoteAddress] = true
+		}
+	}
+	var wg sync.WaitGroup
+	for _, e := range items {
+		switch e.Status {
+		case EvidencePending:
+			if inflight >= params.MaxInflightEvidence || busy[e.VoteA.VoteAddress] {
+				continue
+			}
+			inflight++
+			busy[e.VoteA.VoteAddress] = true
+			wg.Add(1)
+			go func(e *Evidence) {
+				defer wg.Done()
+				s.submit(e, head)
+			}(e)
+		case EvidenceSubmitted:
+			wg.Add(1)
+			go func(e *Evidence) {
+				defer wg.Done()
+				s.checkReceipt(e, head)
+			}(e)
+		case EvidenceIncluded:
+			wg.Add(1)
+			go func(e *Evidence) {
+				defer wg.Done()
+				s.checkFinality(e)
+			}(e)
+		}
+	}
+	wg.Wait()
+}
+
+func (s *Submitter) submit(e *Evidence, head uint64) {
+	if e.Expired(head, params.EvidenceWindow) {
+		s.finish(e, EvidenceExpired)
+		return
+	}
+	if s.superseded(e) {
+		s.finish(e, EvidenceSuperseded)
+		return
+	}
+	if time.Now().Before(e.NextAttempt) {
+		return
+	}
+	if rc, err := includedBefore(s.clients.Client(), e); err != nil {
+		submitterLog.Warn("Failed to check earlier transactions", evidenceCtx(e, "err", err)...)
+		return
+	} else if rc != nil {
+		s.confirm(e, rc)
+		return
+	}
+
+	e.Attempts++
+	if err := SimulateEvidence(s.clients.Client(), s.sender.From(), e.VoteA, e.VoteB); err != nil {
+		if revert, ok := err.(*EvidenceRevertError); ok {
+			e.RevertReason = revert.Reason
+			e.LastError = err.Error()
+			s.finish(e, EvidenceRejected)
+			return
+		}
+		s.retry(e, err)
+		return
+	}
+	data, err := packEvidence(e.VoteA, e.VoteB)
+	if err != nil {
+		s.retry(e, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	tx, err := s.sender.NewTransaction(ctx, SlashIndicatorAddr, data)
+	cancel()
+	if err != nil {
+		s.retry(e, err)
+		return
+	}
+	e.Nonce = tx.Nonce()
+	e.SpeedUps = 0
+	if err := s.send(e, tx, head); err != nil {
+		e.Status = EvidencePending
+		s.retry(e, err)
+		return
+	}
+	evidenceSubmittedCounter.Inc()
+	submitterLog.Info("Evidence submitted", evidenceCtx(e, "tx", e.TxHash.Hex(), "nonce", e.Nonce)...)
+	s.Notifier.EvidenceSubmitted(e)
+}
+
+// send records tx as the latest transaction of e and broadcasts it. The hash
+// is persisted before sending, so a crash right after the send cannot lead to
+// the evidence being submitted twice.
+func (s *Submitter) send(e *Evidence, tx *types.Transaction, head uint64) error {
+	e.Status = EvidenceSubmitted
+	e.TxHash = tx.Hash()
+	e.TxHashes = append(e.TxHashes, tx.Hash())
+	e.SubmittedAt = time.Now()
+	e.SubmittedBlock = head
+	e.LastError = ""
+	s.update(e)
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	return s.sender.Send(ctx, tx)
+}
+
+// retry schedules the next attempt of e after err, or gives up on e when err
+// cannot be fixed by retrying. A revert, e.g. while estimating the gas, means
+// SlashIndicator refuses the evidence. Evidence given up on before a
+// transaction was mined is rejected, reverted is left for a failed receipt.
+func (s *Submitter) retry(e *Evidence, err error) {
+	e.LastError = err.Error()
+	if reason, ok := revertReason(err); ok {
+		e.RevertReason = reason
+		s.finish(e, EvidenceRejected)
+		return
+	}
+	if !IsRetriableSubmitError(err) {
+		s.finish(e, EvidenceRejected)
+		return
+	}
+	e.NextAttempt = time.Now().Add(SubmitBackoff(e.Attempts))
+	submitterLog.Warn("Evidence submission failed", evidenceCtx(e, "attempt", e.Attempts, "retry", e.NextAttempt.Format(time.RFC3339), "err", err)...)
+	s.update(e)
+}
+
+// checkReceipt looks for a receipt of any transaction sent for e, since a
+// replacement or the transaction it replaced may be the one that got mined.
+// A transaction not mined params.FeeBumpBlocks after it was sent is sped up,
+// or cancelled once the evidence has expired.
+func (s *Submitter) checkReceipt(e *Evidence, head uint64) {
+	if mined, err := s.findReceipt(e); err != nil {
+		submitterLog.Warn("Failed to get receipt", evidenceCtx(e, "tx", e.TxHash.Hex(), "err", err)...)
+		return
+	} else if mined {
+		return
+	}
+	if head < e.SubmittedBlock+params.FeeBumpBlocks {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	tx, _, err := s.clients.Client().TransactionByHash(ctx, e.TxHash)
+	cancel()
+	if err == ethereum.NotFound {
+		// the transaction was dropped from the pool, its nonce is free again
+		s.sender.Resync()
+		e.Status = EvidencePending
+		e.LastError = fmt.Sprintf("tx %s dropped", e.TxHash.Hex())
+		e.NextAttempt = time.Now().Add(SubmitBackoff(e.Attempts))
+		submitterLog.Warn("Evidence transaction dropped", evidenceCtx(e, "tx", e.TxHash.Hex())...)
+		s.update(e)
+		return
+	}
+	if err != nil {
+		submitterLog.Warn("Failed to get transaction", evidenceCtx(e, "tx", e.TxHash.Hex(), "err", err)...)
+		return
+	}
+
+	if e.Expired(head, params.EvidenceWindow) {
+		cancelTx, err := s.sender.Cancel(tx)
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+			err = s.sender.Send(ctx, cancelTx)
+			cancel()
+		}
+		if err != nil {
+			submitterLog.Warn("Failed to cancel transaction", evidenceCtx(e, "tx", e.TxHash.Hex(), "err", err)...)
+			return
+		}
+		e.LastError = fmt.Sprintf("tx %s stuck, cancelled by %s", e.TxHash.Hex(), cancelTx.Hash().Hex())
+		s.finish(e, EvidenceExpired)
+		return
+	}
+	s.speedUp(e, tx, head)
+}
+
+// speedUp replaces tx, the stuck transaction of e, by one with a higher gas
+// price, unless e was sped up params.MaxSpeedUps times already. A transaction
+// at the gas price ceiling cannot be sped up, it is left to be mined as is.
+func (s *Submitter) speedUp(e *Evidence, tx *types.Transaction, head uint64) {
+	if e.SpeedUps >= params.MaxSpeedUps {
+		return
+	}
+	replacement, err := s.sender.SpeedUp(tx)
+	if err == errGasPriceCeiling {
+		e.SpeedUps = params.MaxSpeedUps
+		submitterLog.Warn("Gas price at ceiling, not speeding up transaction", evidenceCtx(e, "tx", e.TxHash.Hex(), "gasprice", tx.GasPrice())...)
+		s.update(e)
+		return
+	}
+	if err != nil {
+		submitterLog.Warn("Failed to speed up transaction", evidenceCtx(e, "tx", e.TxHash.Hex(), "err", err)...)
+		return
+	}
+	e.SpeedUps++
+	if err := s.send(e, replacement, head); err != nil {
+		e.LastError = err.Error()
+		submitterLog.Warn("Failed to speed up transaction", evidenceCtx(e, "tx", tx.Hash().Hex(), "err", err)...)
+		s.update(e)
+		return
+	}
+	submitterLog.Info("Evidence transaction sped up", evidenceCtx(e, "tx", tx.Hash().Hex(), "replacement", e.TxHash.Hex())...)
+}
+
+// findReceipt records the outcome of e if one of its transactions was mined,
+// and reports whether one was.
+func (s *Submitter) findReceipt(e *Evidence) (bool, error) {
+	for _, txHash := range e.TxHashes {
+		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+		rc, err := s.chain.TransactionReceipt(ctx, txHash)
+		cancel()
+		if err == ethereum.NotFound {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		e.TxHash = txHash
+		if rc.Status == types.ReceiptStatusSuccessful {
+			s.confirm(e, rc)
+		} else {
+			e.LastError = fmt.Sprintf("tx %s reverted in block %d", txHash.Hex(), rc.BlockNumber)
+			s.finish(e, EvidenceReverted)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// confirm records the on-chain outcome of the successful evidence transaction
+// rc. Evidence is only included if SlashIndicator actually slashed the
+// validator.
+func (s *Submitter) confirm(e *Evidence, rc *types.Receipt) {
+	e.TxHash = rc.TxHash
+	outcome, err := ParseSlashOutcome(rc)
+	if err != nil {
+		e.LastError = fmt.Sprintf("decode logs of tx %s: %v", rc.TxHash.Hex(), err)
+		s.finish(e, EvidenceUnconfirmed)
+		return
+	}
+	e.Outcome = outcome
+	if !outcome.Slashes(e.Validator) {
+		e.LastError = fmt.Sprintf("tx %s mined in block %d without slashing %s", rc.TxHash.Hex(), outcome.BlockNumber, e.Validator.Hex())
+		s.finish(e, EvidenceUnconfirmed)
+		return
+	}
+	for _, felony := range outcome.Felonies {
+		if felony.Validator == e.Validator {
+			submitterLog.Info("Validator fined", evidenceCtx(e, "amount", felony.Amount)...)
+		}
+	}
+	for _, jailed := range outcome.Jailed {
+		if jailed == e.Validator {
+			submitterLog.Info("Validator jailed", e.LogCtx()...)
+		}
+	}
+	e.Status = EvidenceIncluded
+	e.LastError = ""
+	evidenceIncludedCounter.Inc()
+	submitterLog.Info("Evidence included, waiting for finality", evidenceCtx(e, "tx", e.TxHash.Hex(), "block", outcome.BlockNumber)...)
+	s.update(e)
+}
+
+// checkFinality settles included evidence once the canonical block at its
+// height is finalized and still the one it was mined in. If a reorg dropped
+// the block, the evidence goes back to pending, unless one of its
+// transactions made it into the new chain as well.
+func (s *Submitter) checkFinality(e *Evidence) {
+	if e.Outcome == nil {
+		// the block of the evidence is unknown, look it up again
+		s.refetchReceipt(e, "no outcome recorded")
+		return
+	}
+	if atomic.LoadUint64(&s.finalized) < e.Outcome.BlockNumber {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	header, err := s.chain.HeaderByNumber(ctx, new(big.Int).SetUint64(e.Outcome.BlockNumber))
+	cancel()
+	if err != nil {
+		submitterLog.Warn("Failed to get header", evidenceCtx(e, "block", e.Outcome.BlockNumber, "err", err)...)
+		return
+	}
+	if header.Hash() == e.Outcome.BlockHash {
+		s.finish(e, EvidenceSettled)
+		return
+	}
+	evidenceReorgedCounter.Inc()
+	s.refetchReceipt(e, fmt.Sprintf("block %d reorged out", e.Outcome.BlockNumber))
+}
+
+// refetchReceipt confirms e again with the successful receipt of any of its
+// transactions, or re-queues it if none is on chain, for reason.
+func (s *Submitter) refetchReceipt(e *Evidence, reason string) {
+	for _, txHash := range e.TxHashes {
+		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+		rc, err := s.chain.TransactionReceipt(ctx, txHash)
+		cancel()
+		if err == ethereum.NotFound {
+			continue
+		}
+		if err != nil {
+			submitterLog.Warn("Failed to get receipt", evidenceCtx(e, "tx", txHash.Hex(), "err", err)...)
+			return
+		}
+		if rc.Status == types.ReceiptStatusSuccessful {
+			submitterLog.Warn("Evidence transaction found again", evidenceCtx(e, "tx", txHash.Hex(), "block", rc.BlockNumber, "reason", reason)...)
+			s.confirm(e, rc)
+			return
+		}
+	}
+	// the transactions are gone or failed in the new chain, submit again
+	s.sender.Resync()
+	submitterLog.Warn("Evidence transaction not on chain, re-queued", evidenceCtx(e, "tx", e.TxHash.Hex(), "reason", reason)...)
+	e.LastError = fmt.Sprintf("tx %s not on chain: %s", e.TxHash.Hex(), reason)
+	e.Status = EvidencePending
+	e.Outcome = nil
+	e.NextAttempt = time.Now()
+	s.update(e)
+}
+
+// superseded reports whether other evidence against the same validator for
+// votes within the same evidence window has already been included, in which
+// case e would only punish the same misbehaviour a second time.
+func (s *Submitter) superseded(e *Evidence) bool {
+	included := s.queue.Items(func(other *Evidence) bool {
+		if other.ID == e.ID || (other.Status != EvidenceIncluded && other.Status != EvidenceSettled) || other.VoteA.VoteAddress != e.VoteA.VoteAddress {
+			return false
+		}
+		a, b := other.minTarget(), e.minTarget()
+		return a < b+params.EvidenceWindow && b < a+params.EvidenceWindow
+	})
+	return len(included) > 0
+}
+
+func (s *Submitter) finish(e *Evidence, status EvidenceStatus) {
+	e.Status = status
+	evidenceOutcomeCounter.WithLabelValues(string(status)).Inc()
+	if e.LastError != "" {
+		submitterLog.Warn("Evidence finished", evidenceCtx(e, "status", string(status), "err", e.LastError)...)
+	} else {
+		submitterLog.Info("Evidence finished", evidenceCtx(e, "status", string(status))...)
+	}
+	if status.Failed() {
+		s.Notifier.EvidenceFailed(e)
+	}
+	s.update(e)
+}
+
+func (s *Submitter) update(e *Evidence) {
+	if err := s.queue.Update(e); err != nil {
+		storeLog.Error("Failed to persist evidence", evidenceCtx(e, "err", err)...)
+	}
+}
+
+// evidenceCtx returns the log context of e followed by ctx.
+func evidenceCtx(e *Evidence, ctx ...interface{}) []interface{} {
+	return append(e.LogCtx(), ctx...)
+}
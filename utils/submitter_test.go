@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"slash-robot/params"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type testChainBackend struct {
+	headers  map[uint64]*types.Header
+	receipts map[common.Hash]*types.Receipt
+}
+
+func (b *testChainBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if header, ok := b.headers[number.Uint64()]; ok {
+		return header, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+func (b *testChainBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	if rc, ok := b.receipts[txHash]; ok {
+		return rc, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+// newTestSubmitter returns a Submitter over a fresh queue holding one piece
+// of pending evidence.
+func newTestSubmitter(t *testing.T) (*Submitter, *Evidence) {
+	queue, err := NewEvidenceQueue(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, _, err := queue.Add(newTestViolation(9, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Submitter{queue: queue}, e
+}
+
+func TestSubmitterRetry(t *testing.T) {
+	tests := []struct {
+		err    error
+		status EvidenceStatus
+	}{
+		{errors.New("execution reverted: target block too old"), EvidenceRejected},
+		{errors.New("invalid sender"), EvidenceRejected},
+		{errors.New("exceeds block gas limit"), EvidenceRejected},
+		{errors.New("connection refused"), EvidencePending},
+	}
+	for _, test := range tests {
+		s, e := newTestSubmitter(t)
+		s.retry(e, test.err)
+		if e.Status != test.status || e.LastError != test.err.Error() {
+			t.Errorf("%v: got %s (%q), want %s", test.err, e.Status, e.LastError, test.status)
+		}
+		if got, _ := s.queue.Get(e.ID); got.Status != test.status {
+			t.Errorf("%v: persisted %s, want %s", test.err, got.Status, test.status)
+		}
+	}
+}
+
+func TestSubmitterSpeedUpAtCeiling(t *testing.T) {
+	s, e := newTestSubmitter(t)
+	key, _ := crypto.GenerateKey()
+	backend := &testTxBackend{}
+	s.sender = NewTxSender(backend, NewKeySigner(key), big.NewInt(97))
+	tx, err := s.sender.signer.SignTx(types.NewTransaction(0, SlashIndicatorAddr, new(big.Int), 100000, gwei(params.MaxGasPriceGwei), []byte{1}), big.NewInt(97))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Status, e.TxHash = EvidenceSubmitted, tx.Hash()
+
+	for i := 0; i < 2; i++ {
+		s.speedUp(e, tx, 100)
+	}
+	if len(backend.sent) != 0 || e.TxHash != tx.Hash() {
+		t.Fatal("transaction at the gas price ceiling sped up")
+	}
+	if got, _ := s.queue.Get(e.ID); got.SpeedUps != params.MaxSpeedUps {
+		t.Errorf("persisted %d speed ups, want %d", got.SpeedUps, params.MaxSpeedUps)
+	}
+}
+
+func TestSubmitterCheckFinality(t *testing.T) {
+	txHash := common.HexToHash("0x01")
+	canonical := &types.Header{Number: big.NewInt(100)}
+	reorged := &types.Header{Number: big.NewInt(100), Extra: []byte("reorged")}
+	slashed := &types.Receipt{
+		Status:      types.ReceiptStatusSuccessful,
+		TxHash:      txHash,
+		BlockNumber: big.NewInt(101),
+		BlockHash:   common.HexToHash("0x0101"),
+		Logs: []*types.Log{
+			{Address: SlashIndicatorAddr, Topics: []common.Hash{slashABI.Events["validatorSlashed"].ID, common.BytesToHash(testValidator.Bytes())}},
+		},
+	}
+	tests := []struct {
+		name      string
+		outcome   *SlashOutcome
+		finalized uint64
+		receipt   *types.Receipt
+		status    EvidenceStatus
+		block     uint64 // of the outcome afterwards, zero for none
+		resync    bool
+	}{
+		{"not finalized", &SlashOutcome{BlockNumber: 100, BlockHash: canonical.Hash()}, 99, nil, EvidenceIncluded, 100, false},
+		{"settled", &SlashOutcome{BlockNumber: 100, BlockHash: canonical.Hash()}, 100, nil, EvidenceSettled, 100, false},
+		{"reorged, mined again", &SlashOutcome{BlockNumber: 100, BlockHash: reorged.Hash()}, 100, slashed, EvidenceIncluded, 101, false},
+		{"reorged, not on chain", &SlashOutcome{BlockNumber: 100, BlockHash: reorged.Hash()}, 100, nil, EvidencePending, 0, true},
+		{"no outcome", nil, 100, slashed, EvidenceIncluded, 101, false},
+	}
+	for _, test := range tests {
+		s, e := newTestSubmitter(t)
+		backend := &testChainBackend{headers: map[uint64]*types.Header{100: canonical}, receipts: make(map[common.Hash]*types.Receipt)}
+		if test.receipt != nil {
+			backend.receipts[txHash] = test.receipt
+		}
+		key, _ := crypto.GenerateKey()
+		s.chain = backend
+		s.sender = NewTxSender(&testTxBackend{}, NewKeySigner(key), big.NewInt(97))
+		s.sender.synced = true
+		s.finalized = test.finalized
+		e.Status, e.TxHash, e.TxHashes, e.Outcome = EvidenceIncluded, txHash, []common.Hash{txHash}, test.outcome
+
+		s.checkFinality(e)
+		if e.Status != test.status {
+			t.Errorf("%s: got %s, want %s", test.name, e.Status, test.status)
+		}
+		var block uint64
+		if e.Outcome != nil {
+			block = e.Outcome.BlockNumber
+		}
+		if block != test.block {
+			t.Errorf("%s: outcome in block %d, want %d", test.name, block, test.block)
+		}
+		if resync := !s.sender.synced; resync != test.resync {
+			t.Errorf("%s: nonce resync %v, want %v", test.name, resync, test.resync)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slash-robot/params"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+)
+
+var errSubscriptionStalled = errors.New("no notification received")
+
+// SubscribeFunc opens a subscription delivering to a channel owned by the
+// caller, so that every resubscription feeds the same consumer.
+type SubscribeFunc func(ctx context.Context) (ethereum.Subscription, error)
+
+// SubscriptionSupervisor keeps a subscription alive. It resubscribes with
+// backoff when the subscription fails or stays silent for longer than the
+// stall timeout, and reports the gaps in notifications that last. The
+// websocket client redials the node on the first call after the connection
+// dropped, so resubscribing also reconnects. A zero stall timeout disables
+// stall detection, for subscriptions to rare events.
+type SubscriptionSupervisor struct {
+	name         string
+	stallTimeout time.Duration
+	subscribe    SubscribeFunc
+	alive        chan struct{}
+	// OnGapOpen, if set, is called with the time of the last notification
+	// once the subscription has been down for params.NotifyGapThreshold, while
+	// it still is.
+	OnGapOpen func(lastSeen time.Time)
+	// OnGapClosed, if set, is called after resubscribing, when OnGapOpen was
+	// called for the gap.
+	OnGapClosed func(lastSeen time.Time)
+}
+
+func NewSubscriptionSupervisor(name string, stallTimeout time.Duration, subscribe SubscribeFunc) *SubscriptionSupervisor {
+	return &SubscriptionSupervisor{
+		name:         name,
+		stallTimeout: stallTimeout,
+		subscribe:    subscribe,
+		alive:        make(chan struct{}, 1),
+	}
+}
+
+// Alive must be called by the consumer for every notification it receives.
+func (s *SubscriptionSupervisor) Alive() {
+	select {
+	case s.alive <- struct{}{}:
+	default:
+	}
+}
+
+// Subscribe opens the first subscription. Errors are returned, so callers can
+// refuse to start without it.
+func (s *SubscriptionSupervisor) Subscribe() (ethereum.Subscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	sub, err := s.subscribe(ctx)
+	if err == nil {
+		subscriptionLog.Info("Subscribed", "subscription", s.name)
+	}
+	return sub, err
+}
+
+// Run supervises sub, which must come from Subscribe, and every subscription
+// replacing it. A nil sub, after Subscribe failed, is retried right away. It
+// returns once ctx is done, after unsubscribing.
+func (s *SubscriptionSupervisor) Run(ctx context.Context, sub ethereum.Subscription) {
+	for {
+		lastSeen, err := time.Now(), error(nil)
+		if sub != nil {
+			lastSeen, err = s.watch(ctx, sub)
+			sub.Unsubscribe()
+			if ctx.Err() != nil {
+				return
+			}
+			subscriptionFailuresCounter.WithLabelValues(s.name).Inc()
+			subscriptionLog.Warn("Subscription lost", "subscription", s.name, "err", err)
+		}
+
+		var opened bool
+		if sub, opened = s.resubscribe(ctx, lastSeen); sub == nil {
+			return
+		}
+		subscriptionReconnectsCounter.WithLabelValues(s.name).Inc()
+		gap := time.Since(lastSeen)
+		subscriptionGapHistogram.WithLabelValues(s.name).Observe(gap.Seconds())
+		subscriptionLog.Info("Resubscribed", "subscription", s.name, "gap", gap.Round(time.Millisecond))
+		if opened && s.OnGapClosed != nil {
+			s.OnGapClosed(lastSeen)
+		}
+	}
+}
+
+// resubscribe subscribes again with backoff, calling OnGapOpen if that takes
+// until params.NotifyGapThreshold after lastSeen. It returns a nil
+// subscription once ctx is done, and whether the gap was reported.
+func (s *SubscriptionSupervisor) resubscribe(ctx context.Context, lastSeen time.Time) (ethereum.Subscription, bool) {
+	var opened bool
+	open := func() {
+		opened = true
+		subscriptionLog.Warn("Monitoring gap", "subscription", s.name, "last_seen", lastSeen)
+		if s.OnGapOpen != nil {
+			s.OnGapOpen(lastSeen)
+		}
+	}
+	var gapC <-chan time.Time
+	if untilGap := time.Until(lastSeen.Add(params.NotifyGapThreshold)); untilGap > 0 {
+		gapTimer := time.NewTimer(untilGap)
+		defer gapTimer.Stop()
+		gapC = gapTimer.C
+	} else {
+		// a stall is only noticed after the stall timeout
+		open()
+	}
+	for attempts := 1; ; attempts++ {
+		retry := time.After(Backoff(attempts, params.ResubscribeBackoffMin, params.ResubscribeBackoffMax))
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return nil, false
+			case <-gapC:
+				gapC = nil
+				open()
+			case <-retry:
+				break wait
+			}
+		}
+		sub, err := s.Subscribe()
+		if err == nil {
+			return sub, opened
+		}
+		subscriptionLog.Warn("Resubscribe failed", "subscription", s.name, "attempt", attempts, "err", err)
+	}
+}
+
+// watch waits until sub fails or stalls, or ctx is done, and returns when the
+// last notification arrived.
+func (s *SubscriptionSupervisor) watch(ctx context.Context, sub ethereum.Subscription) (time.Time, error) {
+	lastSeen := time.Now()
+	stall := time.NewTimer(s.stallTimeout)
+	defer stall.Stop()
+	stallC := stall.C
+	if s.stallTimeout == 0 {
+		stallC = nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return lastSeen, ctx.Err()
+		case err := <-sub.Err():
+			if err == nil {
+				err = errors.New("subscription closed")
+			}
+			return lastSeen, err
+		case <-s.alive:
+			lastSeen = time.Now()
+			if stallC != nil {
+				if !stall.Stop() {
+					<-stall.C
+				}
+				stall.Reset(s.stallTimeout)
+			}
+		case <-stallC:
+			return lastSeen, fmt.Errorf("%w for %s", errSubscriptionStalled, s.stallTimeout)
+		}
+	}
+}
+
+// Backoff returns how long to wait before the next attempt after the given
+// number of failed attempts: min, doubling with every attempt up to max.
+func Backoff(attempts int, min, max time.Duration) time.Duration {
+	backoff := min
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
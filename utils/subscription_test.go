@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"slash-robot/params"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+)
+
+type testSubscription struct {
+	err          chan error
+	unsubscribed chan struct{}
+}
+
+func (s *testSubscription) Err() <-chan error { return s.err }
+
+func (s *testSubscription) Unsubscribe() {
+	select {
+	case s.unsubscribed <- struct{}{}:
+	default:
+	}
+}
+
+func TestSubscriptionSupervisor(t *testing.T) {
+	defer func(min, max, threshold time.Duration) {
+		params.ResubscribeBackoffMin, params.ResubscribeBackoffMax, params.NotifyGapThreshold = min, max, threshold
+	}(params.ResubscribeBackoffMin, params.ResubscribeBackoffMax, params.NotifyGapThreshold)
+	params.ResubscribeBackoffMin, params.ResubscribeBackoffMax = time.Millisecond, time.Millisecond
+	params.NotifyGapThreshold = 50 * time.Millisecond
+
+	subs := make(chan *testSubscription, 10)
+	var calls int
+	supervisor := NewSubscriptionSupervisor("test", 100*time.Millisecond, func(ctx context.Context) (ethereum.Subscription, error) {
+		// the first resubscription fails, to exercise the retry
+		if calls++; calls == 2 {
+			return nil, errors.New("dial failed")
+		}
+		sub := &testSubscription{err: make(chan error, 1), unsubscribed: make(chan struct{}, 1)}
+		subs <- sub
+		return sub, nil
+	})
+	gaps, resolved := make(chan time.Time, 10), make(chan time.Time, 10)
+	supervisor.OnGapOpen = func(lastSeen time.Time) { gaps <- lastSeen }
+	supervisor.OnGapClosed = func(lastSeen time.Time) { resolved <- lastSeen }
+
+	first, err := supervisor.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-subs
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		supervisor.Run(ctx, first)
+		close(stopped)
+	}()
+
+	// notifications keep the subscription alive past the stall timeout
+	start := time.Now()
+	for time.Since(start) < 250*time.Millisecond {
+		supervisor.Alive()
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-gaps:
+		t.Fatal("resubscribed while notifications arrived")
+	default:
+	}
+
+	// a failed subscription is replaced, too soon to be alerted
+	first.(*testSubscription).err <- errors.New("connection reset")
+	select {
+	case <-subs:
+	case <-time.After(time.Second):
+		t.Fatal("no resubscription after failure")
+	}
+	select {
+	case <-gaps:
+		t.Fatal("short gap reported")
+	default:
+	}
+
+	// a silent subscription is replaced after the stall timeout
+	var last *testSubscription
+	select {
+	case last = <-subs:
+	case <-time.After(time.Second):
+		t.Fatal("no resubscription after stall")
+	}
+	if lastSeen := <-gaps; time.Since(lastSeen) < 100*time.Millisecond {
+		t.Fatal("stall gap too short", time.Since(lastSeen))
+	}
+	select {
+	case <-resolved:
+	case <-time.After(time.Second):
+		t.Fatal("stall gap not resolved")
+	}
+
+	// cancelling stops the supervisor and unsubscribes
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("supervisor did not stop")
+	}
+	select {
+	case <-last.unsubscribed:
+	default:
+		t.Fatal("not unsubscribed on stop")
+	}
+}
+
+func TestSubscriptionGapWhileDown(t *testing.T) {
+	defer func(min, max, threshold time.Duration) {
+		params.ResubscribeBackoffMin, params.ResubscribeBackoffMax, params.NotifyGapThreshold = min, max, threshold
+	}(params.ResubscribeBackoffMin, params.ResubscribeBackoffMax, params.NotifyGapThreshold)
+	params.ResubscribeBackoffMin, params.ResubscribeBackoffMax = 5*time.Millisecond, 5*time.Millisecond
+	params.NotifyGapThreshold = 30 * time.Millisecond
+
+	up := make(chan struct{})
+	supervisor := NewSubscriptionSupervisor("test", 0, func(ctx context.Context) (ethereum.Subscription, error) {
+		select {
+		case <-up:
+			return &testSubscription{err: make(chan error, 1), unsubscribed: make(chan struct{}, 1)}, nil
+		default:
+			return nil, errors.New("dial failed")
+		}
+	})
+	gaps, resolved := make(chan time.Time, 10), make(chan time.Time, 10)
+	supervisor.OnGapOpen = func(lastSeen time.Time) { gaps <- lastSeen }
+	supervisor.OnGapClosed = func(lastSeen time.Time) { resolved <- lastSeen }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go supervisor.Run(ctx, nil)
+
+	// the gap is reported while the endpoint is still down, once
+	select {
+	case <-gaps:
+	case <-time.After(time.Second):
+		t.Fatal("gap not reported while down")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(gaps) != 0 || len(resolved) != 0 {
+		t.Fatal("gap reported again or resolved while down")
+	}
+	close(up)
+	select {
+	case <-resolved:
+	case <-time.After(time.Second):
+		t.Fatal("gap not resolved")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{10, 10 * time.Second},
+	}
+	for _, test := range tests {
+		if backoff := Backoff(test.attempts, time.Second, 10*time.Second); backoff != test.want {
+			t.Errorf("attempt %d: backoff %s, want %s", test.attempts, backoff, test.want)
+		}
+	}
+}
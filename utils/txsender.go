@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"context"
+	"math/big"
+	"slash-robot/params"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// txBackend is the part of ethclient.Client the TxSender needs.
+type txBackend interface {
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+	EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error)
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+}
+
+// TxSender owns the nonce of one account. It hands out consecutive nonces, so
+// several transactions can be in flight at once, and builds replacements for
+// transactions that got stuck.
+type TxSender struct {
+	backend txBackend
+	signer  Signer
+	chainID *big.Int
+	from    common.Address
+
+	mu     sync.Mutex
+	nonce  uint64
+	synced bool
+}
+
+func NewTxSender(backend txBackend, signer Signer, chainID *big.Int) *TxSender {
+	return &TxSender{
+		backend: backend,
+		signer:  signer,
+		chainID: chainID,
+		from:    signer.Address(),
+	}
+}
+
+func (s *TxSender) From() common.Address {
+	return s.from
+}
+
+// NewTransaction signs, but does not send, a transaction calling to with data
+// at the next free nonce.
+func (s *TxSender) NewTransaction(ctx context.Context, to common.Address, data []byte) (*types.Transaction, error) {
+	gas, err := s.backend.EstimateGas(ctx, ethereum.CallMsg{From: s.from, To: &to, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	suggested, err := s.backend.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.synced {
+		nonce, err := s.backend.PendingNonceAt(ctx, s.from)
+		if err != nil {
+			return nil, err
+		}
+		s.nonce, s.synced = nonce, true
+	}
+	tx, err := s.signer.SignTx(types.NewTransaction(s.nonce, to, new(big.Int), GasLimit(gas), GasPrice(suggested), data), s.chainID)
+	if err != nil {
+		return nil, err
+	}
+	s.nonce++
+	return tx, nil
+}
+
+// SpeedUp signs a copy of tx with a higher gas price, which replaces tx in the
+// transaction pool once sent.
+func (s *TxSender) SpeedUp(tx *types.Transaction) (*types.Transaction, error) {
+	gasPrice, err := bumpGasPrice(tx.GasPrice())
+	if err != nil {
+		return nil, err
+	}
+	return s.signer.SignTx(types.NewTransaction(tx.Nonce(), *tx.To(), tx.Value(), tx.Gas(), gasPrice, tx.Data()), s.chainID)
+}
+
+// Cancel signs an empty transfer to ourselves replacing tx, which frees the
+// nonce of tx without running it.
+func (s *TxSender) Cancel(tx *types.Transaction) (*types.Transaction, error) {
+	gasPrice, err := bumpGasPrice(tx.GasPrice())
+	if err != nil {
+		return nil, err
+	}
+	return s.signer.SignTx(types.NewTransaction(tx.Nonce(), s.from, new(big.Int), params.TxGas, gasPrice, nil), s.chainID)
+}
+
+// Send broadcasts tx. If that fails the nonce is read from the node again
+// before the next transaction, so the nonce of tx is reused instead of
+// leaving a gap.
+func (s *TxSender) Send(ctx context.Context, tx *types.Transaction) error {
+	err := s.backend.SendTransaction(ctx, tx)
+	if err == nil || isKnownTxError(err) {
+		return nil
+	}
+	s.Resync()
+	return err
+}
+
+// Resync makes the next transaction read its nonce from the node.
+func (s *TxSender) Resync() {
+	s.mu.Lock()
+	s.synced = false
+	s.mu.Unlock()
+}
+
+func isKnownTxError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction")
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type testTxBackend struct {
+	nonce   uint64
+	sendErr error
+	sent    []*types.Transaction
+}
+
+func (b *testTxBackend) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return b.nonce, nil
+}
+
+func (b *testTxBackend) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(5e9), nil
+}
+
+func (b *testTxBackend) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	return 100000, nil
+}
+
+func (b *testTxBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if b.sendErr != nil {
+		return b.sendErr
+	}
+	b.sent = append(b.sent, tx)
+	return nil
+}
+
+func TestTxSender(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	backend := &testTxBackend{nonce: 7}
+	sender := NewTxSender(backend, NewKeySigner(key), big.NewInt(97))
+	ctx := context.Background()
+
+	for want := uint64(7); want < 10; want++ {
+		tx, err := sender.NewTransaction(ctx, SlashIndicatorAddr, []byte{1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tx.Nonce() != want {
+			t.Fatalf("nonce %d, want %d", tx.Nonce(), want)
+		}
+		if err := sender.Send(ctx, tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a failed send makes the next transaction reuse the nonce the node reports
+	backend.sendErr = errors.New("connection refused")
+	tx, _ := sender.NewTransaction(ctx, SlashIndicatorAddr, []byte{1})
+	if err := sender.Send(ctx, tx); err == nil {
+		t.Fatal("send did not fail")
+	}
+	backend.sendErr, backend.nonce = nil, 10
+	if tx, _ := sender.NewTransaction(ctx, SlashIndicatorAddr, []byte{1}); tx.Nonce() != 10 {
+		t.Fatalf("nonce after failed send %d, want 10", tx.Nonce())
+	}
+	backend.sendErr = errors.New("already known")
+	if err := sender.Send(ctx, tx); err != nil {
+		t.Fatal("known transaction reported as error:", err)
+	}
+
+	replacement, err := sender.SpeedUp(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replacement.Nonce() != tx.Nonce() || replacement.GasPrice().Cmp(big.NewInt(6.16e9)) != 0 {
+		t.Fatal("bad speed up", replacement.Nonce(), replacement.GasPrice())
+	}
+	cancel, err := sender.Cancel(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancel.Nonce() != tx.Nonce() || *cancel.To() != sender.From() || len(cancel.Data()) != 0 || cancel.GasPrice().Cmp(tx.GasPrice()) <= 0 {
+		t.Fatal("bad cancel", cancel.Nonce(), cancel.To(), cancel.GasPrice())
+	}
+}
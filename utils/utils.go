@@ -4,21 +4,21 @@ import (
 	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"log"
 	"math/big"
 	"os"
 	"path"
 	"slash-robot/abi"
+	"slash-robot/params"
+	"sort"
 	"sync"
 	"time"
 
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
 	"github.com/prysmaticlabs/prysm/validator/accounts/iface"
@@ -28,22 +28,47 @@ import (
 )
 
 var (
-	ChainId            = big.NewInt(714)
-	SlashIndicatorAddr = common.HexToAddress("0x0000000000000000000000000000000000001001")
-	TokenHubAddr       = common.HexToAddress("0x0000000000000000000000000000000000001004")
-	RelayerHubAddr     = common.HexToAddress("0x0000000000000000000000000000000000001006")
-	ValidatorSetAddr   = common.HexToAddress("0x0000000000000000000000000000000000001000")
+	ChainId            = new(big.Int).SetUint64(params.ChainID)
+	SlashIndicatorAddr = common.HexToAddress(params.SlashIndicatorAddress)
+	TokenHubAddr       = common.HexToAddress(params.TokenHubAddress)
+	RelayerHubAddr     = common.HexToAddress(params.RelayerHubAddress)
+	ValidatorSetAddr   = common.HexToAddress(params.ValidatorSetAddress)
 )
 
+// ApplyParams derives the chain settings from params again, after
+// params.Config.Apply changed them.
+func ApplyParams() {
+	ChainId = new(big.Int).SetUint64(params.ChainID)
+	SlashIndicatorAddr = common.HexToAddress(params.SlashIndicatorAddress)
+	TokenHubAddr = common.HexToAddress(params.TokenHubAddress)
+	RelayerHubAddr = common.HexToAddress(params.RelayerHubAddress)
+	ValidatorSetAddr = common.HexToAddress(params.ValidatorSetAddress)
+	slashFilterer, _ = abi.NewSlashFilterer(SlashIndicatorAddr, nil)
+	validatorSetFilterer, _ = abi.NewValidatorsetFilterer(ValidatorSetAddr, nil)
+}
+
 type VotesRecordStore struct {
 	VoteRecord map[types.BLSPublicKey]map[uint64]*types.VoteEnvelope
-	mu         sync.RWMutex
-	FileDir    string
+	validators map[types.BLSPublicKey]common.Address
+	// targets holds the targets of VoteRecord per vote address, in ascending
+	// order, so that ranges are found without scanning every vote.
+	targets map[types.BLSPublicKey][]uint64
+	mu      sync.RWMutex
+	FileDir string
+
+	checkpointMu sync.Mutex
+
+	wal  *voteWAL
+	quit chan struct{}
+	wg   sync.WaitGroup
 }
 
-type record struct {
-	Height uint64
-	Vote   *types.VoteEnvelope
+// StoredVote is a vote kept in a VoteStore, tagged with the consensus address
+// of the validator that signed it.
+type StoredVote struct {
+	Height    uint64
+	Vote      *types.VoteEnvelope
+	Validator common.Address
 }
 
 type VoteData struct {
@@ -60,89 +85,89 @@ type slashEvidence struct {
 	VoteAddr []byte
 }
 
-func CheckVote(vote *types.VoteEnvelope, vrStore *VotesRecordStore) (bool, uint64) {
-	voteAddr := vote.VoteAddress
-	voteData := vote.Data
-	// 1. no double vote
-	if _, ok := vrStore.VoteRecord[voteAddr][voteData.TargetNumber]; ok {
-		delete(vrStore.VoteRecord, voteAddr)
-		return false, voteData.TargetNumber
-	}
-	// 2. no vote within the span of other votes
-	for height := voteData.TargetNumber - 1; height > voteData.SourceNumber+1; height-- {
-		if vote, ok := vrStore.VoteRecord[voteAddr][height]; ok {
-			if vote.Data.SourceNumber > voteData.SourceNumber {
-				delete(vrStore.VoteRecord, voteAddr)
-				return false, height
-			}
-		}
-	}
-	vrStore.set(voteAddr, voteData.TargetNumber, vote)
-	return true, 0
-}
-
-func ReportVote(vote1, vote2 *types.VoteEnvelope, client *ethclient.Client) {
+// NewFinalityEvidence packs two conflicting votes of one validator into the
+// evidence accepted by SlashIndicator.
+func NewFinalityEvidence(vote1, vote2 *types.VoteEnvelope) abi.SlashIndicatorFinalityEvidence {
 	var evidence abi.SlashIndicatorFinalityEvidence
 	evidence.VoteA = abi.SlashIndicatorVoteData{
-		SrcNum:  big.NewInt(int64(vote1.Data.SourceNumber)),
+		SrcNum:  new(big.Int).SetUint64(vote1.Data.SourceNumber),
 		SrcHash: vote1.Data.SourceHash,
-		TarNum:  big.NewInt(int64(vote1.Data.TargetNumber)),
+		TarNum:  new(big.Int).SetUint64(vote1.Data.TargetNumber),
 		TarHash: vote1.Data.TargetHash,
 		Sig:     vote1.Signature[:],
 	}
 	evidence.VoteB = abi.SlashIndicatorVoteData{
-		SrcNum:  big.NewInt(int64(vote2.Data.SourceNumber)),
+		SrcNum:  new(big.Int).SetUint64(vote2.Data.SourceNumber),
 		SrcHash: vote2.Data.SourceHash,
-		TarNum:  big.NewInt(int64(vote2.Data.TargetNumber)),
+		TarNum:  new(big.Int).SetUint64(vote2.Data.TargetNumber),
 		TarHash: vote2.Data.TargetHash,
 		Sig:     vote2.Signature[:],
 	}
 	evidence.VoteAddr = vote1.VoteAddress.Bytes()
+	return evidence
+}
 
-	account := SlashAccount
-	account.Key, _ = crypto.HexToECDSA(account.RawKey)
-	ops, _ := bind.NewKeyedTransactorWithChainID(account.Key, ChainId)
-	//ops.GasLimit = 800000
-	slashIndicator, _ := abi.NewSlash(SlashIndicatorAddr, client)
-	tx, err := slashIndicator.SubmitFinalityViolationEvidence(ops, evidence)
+// ReportVote sends the evidence that vote1 and vote2 conflict to
+// SlashIndicator. It does not wait for the transaction to be mined.
+func ReportVote(vote1, vote2 *types.VoteEnvelope, client *ethclient.Client) (*types.Transaction, error) {
+	tx, err := NewEvidenceTx(vote1, vote2, client)
 	if err != nil {
-		log.Fatal("Report Vote:", err)
-	}
-	var rc *types.Receipt
-	for i := 0; i < 180; i++ {
-		rc, err = client.TransactionReceipt(context.Background(), tx.Hash())
-		if err == nil && rc.Status != 0 {
-			fmt.Println("Report Vote: submit evidence success")
-			break
-		}
-		if rc != nil && rc.Status == 0 {
-			log.Fatal("Report Vote: tx failed: ", err, rc)
-		}
-		time.Sleep(100 * time.Millisecond)
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	return tx, client.SendTransaction(ctx, tx)
+}
+
+// NewEvidenceTx signs, but does not send, the transaction submitting the
+// evidence that vote1 and vote2 conflict.
+func NewEvidenceTx(vote1, vote2 *types.VoteEnvelope, client *ethclient.Client) (*types.Transaction, error) {
+	ops := TransactOpts(SlashAccount.Signer, ChainId)
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	ops.Context = ctx
+	ops.NoSend = true
+	data, err := packEvidence(vote1, vote2)
+	if err != nil {
+		return nil, err
 	}
-	if rc == nil {
-		log.Fatal("Report Vote: submit evidence failed")
+	gas, err := client.EstimateGas(ctx, ethereum.CallMsg{From: ops.From, To: &SlashIndicatorAddr, Data: data})
+	if err != nil {
+		return nil, err
 	}
+	ops.GasLimit = GasLimit(gas)
+	suggested, err := client.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ops.GasPrice = GasPrice(suggested)
+	slashIndicator, err := abi.NewSlash(SlashIndicatorAddr, client)
+	if err != nil {
+		return nil, err
+	}
+	return slashIndicator.SubmitFinalityViolationEvidence(ops, NewFinalityEvidence(vote1, vote2))
 }
 
-func TestSlash(vote *types.VoteEnvelope, client *ethclient.Client) {
+// TestSlash reports vote together with a conflicting vote signed by the BLS
+// key of the local test wallet, which exercises SlashIndicator on a devnet.
+func TestSlash(vote *types.VoteEnvelope, client *ethclient.Client) error {
 	keyfile := "./bls/keystore/keystore-wholly-valid-oryx.json"
 	keyJSON, err := ioutil.ReadFile(keyfile)
 	if err != nil {
-		log.Fatal("error read keystore file: ", err)
+		return fmt.Errorf("read keystore file: %v", err)
 	}
 	keystore := &keymanager.Keystore{}
 	if err := json.Unmarshal(keyJSON, keystore); err != nil {
-		log.Fatalf("Could not decode keystore file: %v.", err)
+		return fmt.Errorf("decode keystore file: %v", err)
 	}
 	if keystore.Pubkey == "" {
-		log.Fatalf(" Missing public key, wrong keystore file.")
+		return errors.New("missing public key, wrong keystore file")
 	}
 
 	walletDir := "./bls/wallet"
 	dirExists, err := wallet.Exists(walletDir)
 	if err != nil || !dirExists {
-		log.Fatalf("BLS wallet not exists.")
+		return errors.New("BLS wallet not exists")
 	}
 
 	walletPassword := "password"
@@ -151,15 +176,15 @@ func TestSlash(vote *types.VoteEnvelope, client *ethclient.Client) {
 		WalletPassword: walletPassword,
 	})
 	if err != nil {
-		log.Fatalf("Open BLS wallet failed: %v.", err)
+		return fmt.Errorf("open BLS wallet: %v", err)
 	}
 	km, err := w.InitializeKeymanager(context.Background(), iface.InitKeymanagerConfig{ListenForChanges: false})
 	if err != nil {
-		log.Fatalf("Initialize key manager failed: %v.", err)
+		return fmt.Errorf("initialize key manager: %v", err)
 	}
 	ikm, ok := km.(*imported.Keymanager)
 	if !ok {
-		log.Fatalf("Could not assert keymanager interface to concrete type.")
+		return errors.New("could not assert keymanager interface to concrete type")
 	}
 
 	var fakeVote = &types.VoteEnvelope{
@@ -172,16 +197,25 @@ func TestSlash(vote *types.VoteEnvelope, client *ethclient.Client) {
 	}
 	voteHash := fakeVote.Data.Hash()
 	pubKeys, err := km.FetchValidatingPublicKeys(context.Background())
+	if err != nil || len(pubKeys) == 0 {
+		return fmt.Errorf("fetch public keys: %v", err)
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*50)
 	defer cancel()
 	signature, err := ikm.Sign(ctx, &validatorpb.SignRequest{
 		PublicKey:   pubKeys[0][:],
 		SigningRoot: voteHash[:],
 	})
+	if err != nil {
+		return fmt.Errorf("sign vote: %v", err)
+	}
 	copy(fakeVote.VoteAddress[:], pubKeys[0][:])
 	copy(fakeVote.Signature[:], signature.Marshal()[:])
 
-	ReportVote(vote, fakeVote, client)
+	if _, err := ReportVote(vote, fakeVote, client); err != nil {
+		return fmt.Errorf("report vote: %v", err)
+	}
+	return nil
 }
 
 func newBLSPubKey(voteAddr string) types.BLSPublicKey {
@@ -198,58 +232,173 @@ func newBLSSig(sig string) types.BLSSignature {
 	return BLSSig
 }
 
-func NewVotesRecordStore(fileDir string) *VotesRecordStore {
+// NewVotesRecordStore loads the vote history kept in fileDir, migrating the
+// legacy vote files, and starts checkpointing it.
+func NewVotesRecordStore(fileDir string) (*VotesRecordStore, error) {
 	vrStore := &VotesRecordStore{
 		VoteRecord: make(map[types.BLSPublicKey]map[uint64]*types.VoteEnvelope),
+		validators: make(map[types.BLSPublicKey]common.Address),
+		targets:    make(map[types.BLSPublicKey][]uint64),
 		FileDir:    fileDir,
+		quit:       make(chan struct{}),
+	}
+	wal, err := newVoteWAL(fileDir)
+	if err != nil {
+		return nil, err
+	}
+	err = wal.replay(func(voteAddr types.BLSPublicKey, r *StoredVote) {
+		vrStore.setLocked(voteAddr, r)
+	})
+	if err != nil {
+		_ = wal.close()
+		return nil, fmt.Errorf("replay wal: %v", err)
 	}
-	files, err := ioutil.ReadDir(fileDir)
+	legacy, err := vrStore.importLegacyVoteFiles()
 	if err != nil {
-		log.Fatal("VotesRecordStore:", err)
+		_ = wal.close()
+		return nil, fmt.Errorf("migrate legacy files: %v", err)
 	}
-	for _, file := range files {
-		if len(file.Name()) != 53 {
-			continue
+	vrStore.wal = wal
+	// compact the replayed logs right away so that torn tails are dropped and
+	// migrated votes are persisted in the current format
+	if err := vrStore.Checkpoint(); err != nil {
+		_ = wal.close()
+		return nil, fmt.Errorf("checkpoint: %v", err)
+	}
+	for _, filePath := range legacy {
+		if err := os.Remove(filePath); err != nil {
+			_ = vrStore.Close()
+			return nil, fmt.Errorf("remove legacy file: %v", err)
 		}
-		go vrStore.load(file.Name())
+		storeLog.Info("Migrated legacy vote file", "file", filePath)
 	}
-	return vrStore
+
+	vrStore.wg.Add(1)
+	go vrStore.checkpointLoop(params.CheckpointInterval)
+	return vrStore, nil
 }
 
-func (vr *VotesRecordStore) set(voteAddr types.BLSPublicKey, height uint64, vote *types.VoteEnvelope) bool {
+func (vr *VotesRecordStore) set(voteAddr types.BLSPublicKey, r *StoredVote) bool {
 	vr.mu.Lock()
 	defer vr.mu.Unlock()
+	if vr.wal != nil {
+		if err := vr.wal.append(voteAddr, r); err != nil {
+			storeLog.Error("Failed to write wal", "vote_address", common.Bytes2Hex(voteAddr.Bytes()), "target", r.Height, "err", err)
+		}
+	}
+	vr.setLocked(voteAddr, r)
+	return true
+}
+
+func (vr *VotesRecordStore) setLocked(voteAddr types.BLSPublicKey, r *StoredVote) {
 	if _, ok := vr.VoteRecord[voteAddr]; !ok {
 		vr.VoteRecord[voteAddr] = make(map[uint64]*types.VoteEnvelope)
 	}
-	vr.VoteRecord[voteAddr][height] = vote
-	if _, ok := vr.VoteRecord[voteAddr][height-256]; ok {
-		delete(vr.VoteRecord[voteAddr], height-256)
+	if _, ok := vr.VoteRecord[voteAddr][r.Height]; !ok {
+		vr.indexLocked(voteAddr)
+		targets := vr.targets[voteAddr]
+		i := sort.Search(len(targets), func(i int) bool { return targets[i] >= r.Height })
+		targets = append(targets, 0)
+		copy(targets[i+1:], targets[i:])
+		targets[i] = r.Height
+		vr.targets[voteAddr] = targets
+	}
+	vr.VoteRecord[voteAddr][r.Height] = r.Vote
+	if r.Validator != (common.Address{}) {
+		if vr.validators == nil {
+			vr.validators = make(map[types.BLSPublicKey]common.Address)
+		}
+		vr.validators[voteAddr] = r.Validator
 	}
-	return true
 }
 
-func (vr *VotesRecordStore) load(file string) error {
-	filePath := path.Join(vr.FileDir, file)
-	f, err := os.Open(filePath)
-	defer f.Close()
-	if err != nil {
-		log.Fatal("Err saveLoop VotesRecordStore:", err)
+func (vr *VotesRecordStore) storedLocked(voteAddr types.BLSPublicKey, height uint64, vote *types.VoteEnvelope) *StoredVote {
+	return &StoredVote{Height: height, Vote: vote, Validator: vr.validators[voteAddr]}
+}
+
+// Checkpoint rewrites the write-ahead log of every validator with the votes
+// currently held in memory, truncating entries that have since been pruned.
+func (vr *VotesRecordStore) Checkpoint() error {
+	if vr.wal == nil {
+		return nil
 	}
-	if _, err := f.Seek(0, 0); err != nil {
-		return err
+	vr.checkpointMu.Lock()
+	defer vr.checkpointMu.Unlock()
+
+	// snapshot the history, and write it once votes can be added again
+	vr.mu.RLock()
+	snapshot := make(map[types.BLSPublicKey][]*StoredVote, len(vr.VoteRecord))
+	voteAddrs := make([]types.BLSPublicKey, 0, len(vr.VoteRecord))
+	for voteAddr, votes := range vr.VoteRecord {
+		records := make([]*StoredVote, 0, len(votes))
+		for height, vote := range votes {
+			records = append(records, vr.storedLocked(voteAddr, height, vote))
+		}
+		snapshot[voteAddr] = records
+		voteAddrs = append(voteAddrs, voteAddr)
 	}
-	var voteAddr types.BLSPublicKey
-	copy(voteAddr[:], file[:len(file)-5])
-	d := json.NewDecoder(f)
-	for err == nil {
-		var r record
-		if err = d.Decode(&r); err == nil {
-			vr.set(voteAddr, r.Height, r.Vote)
+	vr.wal.begin(voteAddrs)
+	vr.mu.RUnlock()
+	defer vr.wal.end()
+
+	for voteAddr, records := range snapshot {
+		sort.Slice(records, func(i, j int) bool { return records[i].Height < records[j].Height })
+		if err := vr.wal.rewrite(voteAddr, records); err != nil {
+			return err
 		}
 	}
-	if err == io.EOF {
+	return nil
+}
+
+func (vr *VotesRecordStore) checkpointLoop(interval time.Duration) {
+	defer vr.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := vr.Checkpoint(); err != nil {
+				storeLog.Error("Checkpoint failed", "err", err)
+			}
+		case <-vr.quit:
+			return
+		}
+	}
+}
+
+// Close stops the checkpoint loop, writes a final checkpoint and closes the
+// write-ahead log.
+func (vr *VotesRecordStore) Close() error {
+	if vr.wal == nil {
 		return nil
 	}
-	return err
+	close(vr.quit)
+	vr.wg.Wait()
+	if err := vr.Checkpoint(); err != nil {
+		return err
+	}
+	return vr.wal.close()
+}
+
+// importLegacyVoteFiles loads the files written by the old shutdown code and
+// returns their paths. Votes already known from the write-ahead log win, as
+// they are newer.
+func (vr *VotesRecordStore) importLegacyVoteFiles() ([]string, error) {
+	legacy, err := legacyVoteFiles(vr.FileDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, filePath := range legacy {
+		records, err := readLegacyVoteFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filePath, err)
+		}
+		voteAddr := newBLSPubKey(path.Base(filePath))
+		for _, r := range records {
+			if _, ok := vr.VoteRecord[voteAddr][r.Height]; !ok {
+				vr.setLocked(voteAddr, r)
+			}
+		}
+	}
+	return legacy, nil
 }
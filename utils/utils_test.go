@@ -9,7 +9,6 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 )
 
 type checkVote struct {
@@ -97,23 +96,27 @@ func newVoteRecord(voteAddr string, srcNum, tarNum uint64) map[types.BLSPublicKe
 
 func TestCheckVote(t *testing.T) {
 	for _, item := range checkVoteList {
-		if flag, _ := CheckVote(item.vote, item.vrStore); flag {
+		if flag, _ := CheckVote(item.vote, common.Address{}, item.vrStore); flag {
 			t.Error("check vote wrong", item)
 		}
 	}
 }
 
 func TestReportVote(t *testing.T) {
-	client := GetCurrentClient("geth_ws")
+	client, err := GetCurrentClient("geth_ws")
+	if err != nil {
+		t.Fatal(err)
+	}
 	for _, item := range submitEvidenceList {
 		ReportVote(item.Vote1, item.Vote2, client)
 	}
 }
 
 func TestContractCall(t *testing.T) {
-	client := GetCurrentClient("geth_ws")
-	account := SlashAccount
-	account.Key, _ = crypto.HexToECDSA(account.RawKey)
+	client, err := GetCurrentClient("geth_ws")
+	if err != nil {
+		t.Fatal(err)
+	}
 	validatorSet, _ := abi.NewValidatorset(ValidatorSetAddr, client)
 
 	out1, out2, err := validatorSet.GetLivingValidators(&bind.CallOpts{})
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// validatorSetCaller is the part of the BSCValidatorSet contract binding the
+// ValidatorSet reads.
+type validatorSetCaller interface {
+	GetLivingValidators(opts *bind.CallOpts) ([]common.Address, [][]byte, error)
+}
+
+// ValidatorSet maps the vote addresses of the current validators to their
+// consensus addresses. Members of the previous set are still accepted, so
+// votes signed just before an update are not dropped.
+type ValidatorSet struct {
+	caller validatorSetCaller
+
+	refreshMu sync.Mutex // serializes Refresh
+	mu        sync.RWMutex
+	current   map[types.BLSPublicKey]common.Address
+	previous  map[types.BLSPublicKey]common.Address
+}
+
+func NewValidatorSet(caller validatorSetCaller) *ValidatorSet {
+	return &ValidatorSet{
+		caller:   caller,
+		current:  make(map[types.BLSPublicKey]common.Address),
+		previous: make(map[types.BLSPublicKey]common.Address),
+	}
+}
+
+// Refresh reloads the validator set from the BSCValidatorSet contract. The set
+// only changes when an epoch turns, so the previous set is rotated out only if
+// the reloaded set differs from the current one.
+func (vs *ValidatorSet) Refresh() error {
+	vs.refreshMu.Lock()
+	defer vs.refreshMu.Unlock()
+
+	validators, voteAddrs, err := vs.caller.GetLivingValidators(&bind.CallOpts{})
+	if err != nil {
+		return fmt.Errorf("get validators: %v", err)
+	}
+	if len(voteAddrs) != len(validators) {
+		return fmt.Errorf("got %d vote addresses for %d validators", len(voteAddrs), len(validators))
+	}
+	current := make(map[types.BLSPublicKey]common.Address, len(validators))
+	for i, validator := range validators {
+		if len(voteAddrs[i]) != types.BLSPublicKeyLength {
+			continue
+		}
+		var voteAddr types.BLSPublicKey
+		copy(voteAddr[:], voteAddrs[i])
+		current[voteAddr] = validator
+	}
+
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	if !sameValidators(vs.current, current) {
+		vs.previous = vs.current
+		vs.current = current
+	}
+	validatorSetSizeGauge.Set(float64(len(vs.current)))
+	return nil
+}
+
+func sameValidators(a, b map[types.BLSPublicKey]common.Address) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for voteAddr, validator := range a {
+		if other, ok := b[voteAddr]; !ok || other != validator {
+			return false
+		}
+	}
+	return true
+}
+
+// Lookup returns the consensus address of the validator owning voteAddr.
+func (vs *ValidatorSet) Lookup(voteAddr types.BLSPublicKey) (common.Address, bool) {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+	if validator, ok := vs.current[voteAddr]; ok {
+		return validator, true
+	}
+	validator, ok := vs.previous[voteAddr]
+	return validator, ok
+}
+
+// Voter returns the consensus address of the validator that signed vote. Votes
+// from vote addresses outside the validator set are counted as dropped.
+func (vs *ValidatorSet) Voter(vote *types.VoteEnvelope) (common.Address, bool) {
+	validator, ok := vs.Lookup(vote.VoteAddress)
+	if !ok {
+		unknownVotesCounter.Inc()
+	}
+	return validator, ok
+}
+
+func (vs *ValidatorSet) Len() int {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+	return len(vs.current)
+}
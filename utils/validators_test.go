@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type testValidatorSetCaller struct {
+	validators []common.Address
+	voteAddrs  [][]byte
+}
+
+func (c *testValidatorSetCaller) GetLivingValidators(opts *bind.CallOpts) ([]common.Address, [][]byte, error) {
+	return c.validators, c.voteAddrs, nil
+}
+
+func TestValidatorSetRefresh(t *testing.T) {
+	var left, joined types.BLSPublicKey
+	left[0], joined[0] = 1, 2
+	caller := &testValidatorSetCaller{
+		validators: []common.Address{common.HexToAddress("0x01")},
+		voteAddrs:  [][]byte{left[:]},
+	}
+	vs := NewValidatorSet(caller)
+	if err := vs.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	caller.validators = []common.Address{common.HexToAddress("0x02")}
+	caller.voteAddrs = [][]byte{joined[:]}
+	for i := 0; i < 2; i++ {
+		// a second refresh in the same epoch must keep the previous set
+		if err := vs.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := vs.Lookup(left); !ok {
+			t.Fatalf("refresh %d: validator of the previous set not accepted", i)
+		}
+		if _, ok := vs.Lookup(joined); !ok {
+			t.Fatalf("refresh %d: validator of the current set not accepted", i)
+		}
+	}
+	if vs.Len() != 1 {
+		t.Errorf("got %d validators, want 1", vs.Len())
+	}
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	invalidVoteMalformed = "malformed"
+	invalidVoteSignature = "signature"
+)
+
+// InvalidVoteError is returned by VerifyVote for a vote that must be neither
+// stored nor used as evidence.
+type InvalidVoteError struct {
+	Reason string
+	Err    error
+}
+
+func (e *InvalidVoteError) Error() string {
+	return fmt.Sprintf("invalid vote (%s): %v", e.Reason, e.Err)
+}
+
+// VerifyVote checks that vote is well formed and that Signature was made by
+// VoteAddress over the hash of the vote data. Invalid votes are counted by
+// reason.
+func VerifyVote(vote *types.VoteEnvelope) error {
+	err := verifyVote(vote)
+	if e, ok := err.(*InvalidVoteError); ok {
+		invalidVotesCounter.WithLabelValues(e.Reason).Inc()
+	}
+	return err
+}
+
+func verifyVote(vote *types.VoteEnvelope) error {
+	if vote == nil || vote.Data == nil {
+		return &InvalidVoteError{Reason: invalidVoteMalformed, Err: errors.New("missing vote data")}
+	}
+	if vote.Data.SourceNumber >= vote.Data.TargetNumber {
+		return &InvalidVoteError{Reason: invalidVoteMalformed, Err: fmt.Errorf("source %d not below target %d", vote.Data.SourceNumber, vote.Data.TargetNumber)}
+	}
+	if err := vote.Verify(); err != nil {
+		return &InvalidVoteError{Reason: invalidVoteSignature, Err: err}
+	}
+	return nil
+}
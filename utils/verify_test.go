@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+)
+
+func newSignedTestVote(t *testing.T, srcNum, tarNum uint64) *types.VoteEnvelope {
+	secretKey, err := bls.RandKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vote := newTestVote(walTestVoteAddr, srcNum, tarNum)
+	copy(vote.VoteAddress[:], secretKey.PublicKey().Marshal())
+	voteHash := vote.Data.Hash()
+	copy(vote.Signature[:], secretKey.Sign(voteHash[:]).Marshal())
+	return vote
+}
+
+func TestVerifyVote(t *testing.T) {
+	if err := VerifyVote(newSignedTestVote(t, 1, 2)); err != nil {
+		t.Error("valid vote rejected:", err)
+	}
+
+	tampered := newSignedTestVote(t, 1, 2)
+	tampered.Data.TargetNumber = 3
+	if err, ok := VerifyVote(tampered).(*InvalidVoteError); !ok || err.Reason != invalidVoteSignature {
+		t.Error("vote with tampered data accepted:", err)
+	}
+
+	forged := newSignedTestVote(t, 1, 2)
+	copy(forged.VoteAddress[:], newSignedTestVote(t, 1, 2).VoteAddress[:])
+	if err, ok := VerifyVote(forged).(*InvalidVoteError); !ok || err.Reason != invalidVoteSignature {
+		t.Error("vote signed by another key accepted:", err)
+	}
+
+	if err, ok := VerifyVote(newSignedTestVote(t, 2, 2)).(*InvalidVoteError); !ok || err.Reason != invalidVoteMalformed {
+		t.Error("vote with source at target accepted:", err)
+	}
+}
@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// On-disk format of the vote history, one file per validator named
+// <hex vote address>.wal:
+//
+//	{"Version":1}
+//	{"Height":<target number>,"Vote":<types.VoteEnvelope>,"Validator":<consensus address>}
+//	...
+//
+// The first line is a header, every following line is one record. Checkpoints
+// rewrite the whole file, the write-ahead log appends records to it.
+const voteFileVersion = 1
+
+type voteFileHeader struct {
+	Version int
+}
+
+func encodeVoteFileHeader() []byte {
+	data, _ := json.Marshal(&voteFileHeader{Version: voteFileVersion})
+	return append(data, '\n')
+}
+
+// writeVoteFile atomically replaces filePath with a file holding records.
+func writeVoteFile(filePath string, records []*StoredVote) error {
+	tmp, err := os.OpenFile(filePath+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(tmp)
+	_, err = bw.Write(encodeVoteFileHeader())
+	e := json.NewEncoder(bw)
+	for _, r := range records {
+		if err != nil {
+			break
+		}
+		err = e.Encode(r)
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// appendVoteFile adds records to the end of filePath.
+func appendVoteFile(filePath string, records []*StoredVote) error {
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	e := json.NewEncoder(bw)
+	for _, r := range records {
+		if err = e.Encode(r); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readVoteFile hands every readable record of filePath to fn. A torn or
+// corrupt line, e.g. from a crash in the middle of a write, is skipped. Files
+// written before the header was introduced are read as plain record streams.
+func readVoteFile(filePath string, fn func(*StoredVote)) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if line == 1 {
+			var header voteFileHeader
+			if err := json.Unmarshal(scanner.Bytes(), &header); err == nil && header.Version != 0 {
+				if header.Version > voteFileVersion {
+					return fmt.Errorf("%s: unsupported vote file version %d", filePath, header.Version)
+				}
+				continue
+			}
+		}
+		var r StoredVote
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil || r.Vote == nil || r.Vote.Data == nil {
+			storeLog.Warn("Skipping corrupt vote entry", "file", filePath, "line", line)
+			continue
+		}
+		fn(&r)
+	}
+	return scanner.Err()
+}
+
+// isLegacyVoteFile reports whether name is a file written by the old shutdown
+// code in main, which dumped map[uint64]*types.VoteEnvelope as one JSON object
+// into a file named after the hex vote address.
+func isLegacyVoteFile(name string) bool {
+	if len(name) != 2*types.BLSPublicKeyLength {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// readLegacyVoteFile reads a file written by the old shutdown code and returns
+// its records ordered by height.
+func readLegacyVoteFile(filePath string) ([]*StoredVote, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	votes := make(map[uint64]*types.VoteEnvelope)
+	if err := json.NewDecoder(f).Decode(&votes); err != nil && err != io.EOF {
+		return nil, err
+	}
+	records := make([]*StoredVote, 0, len(votes))
+	for height, vote := range votes {
+		if vote == nil || vote.Data == nil {
+			continue
+		}
+		records = append(records, &StoredVote{Height: height, Vote: vote})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Height < records[j].Height })
+	return records, nil
+}
+
+// legacyVoteFiles lists the files in dir written by the old shutdown code.
+func legacyVoteFiles(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var legacy []string
+	for _, file := range files {
+		if !file.IsDir() && isLegacyVoteFile(file.Name()) {
+			legacy = append(legacy, path.Join(dir, file.Name()))
+		}
+	}
+	return legacy, nil
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// writeLegacyVoteFile writes the votes 20..24 in the format of the old
+// shutdown code to dir and returns them with the file path.
+func writeLegacyVoteFile(t *testing.T, dir string) (map[uint64]*types.VoteEnvelope, string) {
+	legacy := make(map[uint64]*types.VoteEnvelope)
+	for tarNum := uint64(20); tarNum < 25; tarNum++ {
+		legacy[tarNum] = newTestVote(walTestVoteAddr, tarNum-1, tarNum)
+	}
+	data, _ := json.Marshal(legacy)
+	legacyPath := path.Join(dir, walTestVoteAddr)
+	if err := os.WriteFile(legacyPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return legacy, legacyPath
+}
+
+func TestMigrateLegacyVoteFiles(t *testing.T) {
+	dir := t.TempDir()
+	legacy, legacyPath := writeLegacyVoteFile(t, dir)
+
+	vrStore, err := NewVotesRecordStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vrStore.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(legacyPath); !os.IsNotExist(err) {
+		t.Error("legacy file not removed after migration")
+	}
+
+	restored, err := NewVotesRecordStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	voteAddr := newBLSPubKey(walTestVoteAddr)
+	for tarNum := range legacy {
+		vote, ok := restored.VoteRecord[voteAddr][tarNum]
+		if !ok || vote.Data.TargetNumber != tarNum || vote.VoteAddress != voteAddr {
+			t.Error("migrated vote not reloaded at", tarNum)
+		}
+	}
+}
+
+func TestMigrateLegacyVoteFilesLevelDB(t *testing.T) {
+	dir := t.TempDir()
+	legacy, legacyPath := writeLegacyVoteFile(t, dir)
+	store, err := NewVoteStore(LevelDBBackend, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, err := os.Stat(legacyPath); !os.IsNotExist(err) {
+		t.Error("legacy file not removed after migration")
+	}
+	voteAddr := newBLSPubKey(walTestVoteAddr)
+	for tarNum := range legacy {
+		vote, err := store.Get(voteAddr, tarNum)
+		if err != nil || vote == nil || vote.Vote.Data.TargetNumber != tarNum {
+			t.Error("migrated vote missing at", tarNum, err)
+		}
+	}
+}
+
+func TestReadVoteFileVersion(t *testing.T) {
+	filePath := path.Join(t.TempDir(), walTestVoteAddr+walSuffix)
+	if err := os.WriteFile(filePath, []byte("{\"Version\":99}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := readVoteFile(filePath, func(*StoredVote) {}); err == nil {
+		t.Error("vote file of unknown version accepted")
+	}
+}
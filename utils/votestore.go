@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	MemoryBackend  = "memory"
+	LevelDBBackend = "leveldb"
+)
+
+// VoteStore keeps the vote history of every validator that CheckVote compares
+// new votes against.
+type VoteStore interface {
+	// Put stores vote of validator under its vote address and target number.
+	Put(validator common.Address, vote *types.VoteEnvelope) error
+	// Get returns the vote of voteAddr for target, or nil if there is none.
+	Get(voteAddr types.BLSPublicKey, target uint64) (*StoredVote, error)
+	// RangeByTarget calls fn in ascending target order for every vote of
+	// voteAddr with from <= target <= to, until fn returns false.
+	RangeByTarget(voteAddr types.BLSPublicKey, from, to uint64, fn func(*StoredVote) bool) error
+	// PruneBelow deletes every vote with a target below height and returns
+	// how many were deleted.
+	PruneBelow(height uint64) (int, error)
+	// Len returns the number of stored votes.
+	Len() (int, error)
+	Close() error
+}
+
+// NewVoteStore opens the vote history kept in dir with the given backend.
+func NewVoteStore(backend, dir string) (VoteStore, error) {
+	switch backend {
+	case MemoryBackend:
+		return NewVotesRecordStore(dir)
+	case LevelDBBackend:
+		store, err := NewLevelDBVoteStore(path.Join(dir, "leveldb"))
+		if err != nil {
+			return nil, err
+		}
+		if err := store.importLegacyVoteFiles(dir); err != nil {
+			_ = store.Close()
+			return nil, fmt.Errorf("migrate legacy files: %v", err)
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown vote store backend %q", backend)
+	}
+}
+
+func (vr *VotesRecordStore) Put(validator common.Address, vote *types.VoteEnvelope) error {
+	vr.set(vote.VoteAddress, &StoredVote{Height: vote.Data.TargetNumber, Vote: vote, Validator: validator})
+	return nil
+}
+
+func (vr *VotesRecordStore) Get(voteAddr types.BLSPublicKey, target uint64) (*StoredVote, error) {
+	vr.mu.RLock()
+	defer vr.mu.RUnlock()
+	vote, ok := vr.VoteRecord[voteAddr][target]
+	if !ok {
+		return nil, nil
+	}
+	return vr.storedLocked(voteAddr, target, vote), nil
+}
+
+// RangeByTarget seeks from in the target index of voteAddr. fn is called with
+// the store read locked, so it must not modify the store.
+func (vr *VotesRecordStore) RangeByTarget(voteAddr types.BLSPublicKey, from, to uint64, fn func(*StoredVote) bool) error {
+	vr.mu.RLock()
+	if !vr.indexedLocked(voteAddr) {
+		vr.mu.RUnlock()
+		vr.mu.Lock()
+		vr.indexLocked(voteAddr)
+		vr.mu.Unlock()
+		vr.mu.RLock()
+	}
+	defer vr.mu.RUnlock()
+	targets := vr.targets[voteAddr]
+	for i := sort.Search(len(targets), func(i int) bool { return targets[i] >= from }); i < len(targets) && targets[i] <= to; i++ {
+		vote, ok := vr.VoteRecord[voteAddr][targets[i]]
+		if !ok {
+			continue
+		}
+		if !fn(vr.storedLocked(voteAddr, targets[i], vote)) {
+			break
+		}
+	}
+	return nil
+}
+
+// indexedLocked reports whether the target index of voteAddr is up to date.
+// It is not for histories assigned to VoteRecord directly.
+func (vr *VotesRecordStore) indexedLocked(voteAddr types.BLSPublicKey) bool {
+	return len(vr.targets[voteAddr]) == len(vr.VoteRecord[voteAddr])
+}
+
+// indexLocked rebuilds the target index of voteAddr if it is out of date.
+func (vr *VotesRecordStore) indexLocked(voteAddr types.BLSPublicKey) {
+	if vr.targets == nil {
+		vr.targets = make(map[types.BLSPublicKey][]uint64)
+	}
+	if vr.indexedLocked(voteAddr) {
+		return
+	}
+	targets := make([]uint64, 0, len(vr.VoteRecord[voteAddr]))
+	for target := range vr.VoteRecord[voteAddr] {
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i] < targets[j] })
+	vr.targets[voteAddr] = targets
+}
+
+func (vr *VotesRecordStore) Len() (int, error) {
+	vr.mu.RLock()
+	defer vr.mu.RUnlock()
+	var n int
+	for _, votes := range vr.VoteRecord {
+		n += len(votes)
+	}
+	return n, nil
+}
+
+func (vr *VotesRecordStore) PruneBelow(height uint64) (int, error) {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+	var pruned int
+	for voteAddr, votes := range vr.VoteRecord {
+		vr.indexLocked(voteAddr)
+		targets := vr.targets[voteAddr]
+		n := sort.Search(len(targets), func(i int) bool { return targets[i] >= height })
+		for _, target := range targets[:n] {
+			delete(votes, target)
+		}
+		vr.targets[voteAddr] = append(targets[:0], targets[n:]...)
+		pruned += n
+		// forget validators that stopped voting, with their log
+		if len(votes) == 0 {
+			delete(vr.VoteRecord, voteAddr)
+			delete(vr.validators, voteAddr)
+			delete(vr.targets, voteAddr)
+			if vr.wal != nil {
+				if err := vr.wal.remove(voteAddr); err != nil {
+					return pruned, err
+				}
+			}
+		}
+	}
+	return pruned, nil
+}
@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestVoteStoreBackends(t *testing.T) {
+	for _, backend := range []string{MemoryBackend, LevelDBBackend} {
+		store, err := NewVoteStore(backend, t.TempDir())
+		if err != nil {
+			t.Fatal(backend, err)
+		}
+		testVoteStore(t, backend, store)
+		if err := store.Close(); err != nil {
+			t.Error(backend, err)
+		}
+	}
+}
+
+func testVoteStore(t *testing.T, backend string, store VoteStore) {
+	voteAddr := newBLSPubKey(walTestVoteAddr)
+	for tarNum := uint64(10); tarNum < 20; tarNum++ {
+		if err := store.Put(testValidator, newTestVote(walTestVoteAddr, tarNum-1, tarNum)); err != nil {
+			t.Fatal(backend, err)
+		}
+	}
+
+	if vote, err := store.Get(voteAddr, 15); err != nil || vote == nil || vote.Vote.Data.SourceNumber != 14 || vote.Validator != testValidator {
+		t.Error(backend, "get stored vote", vote, err)
+	}
+	if vote, err := store.Get(voteAddr, 25); err != nil || vote != nil {
+		t.Error(backend, "get missing vote", vote, err)
+	}
+
+	var targets []uint64
+	err := store.RangeByTarget(voteAddr, 12, 16, func(vote *StoredVote) bool {
+		targets = append(targets, vote.Height)
+		return vote.Height < 15
+	})
+	if err != nil || len(targets) != 4 || targets[0] != 12 || targets[3] != 15 {
+		t.Error(backend, "range by target", targets, err)
+	}
+
+	if pruned, err := store.PruneBelow(14); err != nil || pruned != 4 {
+		t.Error(backend, "prune below", pruned, err)
+	}
+	if vote, _ := store.Get(voteAddr, 13); vote != nil {
+		t.Error(backend, "vote below prune height kept")
+	}
+	if n, err := store.Len(); err != nil || n != 6 {
+		t.Error(backend, "len", n, err)
+	}
+
+	if ok, _ := CheckVote(newTestVote(walTestVoteAddr, 10, 16), testValidator, store); ok {
+		t.Error(backend, "double vote not detected")
+	}
+}
+
+func TestPruneVotes(t *testing.T) {
+	store, err := NewVotesRecordStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	voteAddr := newBLSPubKey(walTestVoteAddr)
+	// a validator that skipped heights 13 and 14
+	for _, tarNum := range []uint64{10, 11, 12, 15, 16} {
+		_ = store.Put(testValidator, newTestVote(walTestVoteAddr, tarNum-1, tarNum))
+	}
+	if pruned, err := PruneVotes(store, 10, 16); err != nil || pruned != 0 {
+		t.Error("pruned ahead of finality", pruned, err)
+	}
+	if pruned, err := PruneVotes(store, 20, 5); err != nil || pruned != 3 {
+		t.Error("prune below finality", pruned, err)
+	}
+	if n := len(store.VoteRecord[voteAddr]); n != 2 {
+		t.Error("votes left after prune, want 2 got", n)
+	}
+}
+
+func TestRangeByTargetIndex(t *testing.T) {
+	store, err := NewVotesRecordStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	voteAddr := newBLSPubKey(walTestVoteAddr)
+	for _, tarNum := range []uint64{16, 11, 14, 10, 15, 12, 14} {
+		_ = store.Put(testValidator, newTestVote(walTestVoteAddr, tarNum-1, tarNum))
+	}
+	rangeTargets := func(from, to uint64) []uint64 {
+		var targets []uint64
+		_ = store.RangeByTarget(voteAddr, from, to, func(vote *StoredVote) bool {
+			targets = append(targets, vote.Height)
+			return true
+		})
+		return targets
+	}
+	if got := fmt.Sprint(rangeTargets(11, 15)); got != "[11 12 14 15]" {
+		t.Error("range 11..15, got", got)
+	}
+	if pruned, err := store.PruneBelow(12); err != nil || pruned != 2 {
+		t.Error("prune below", pruned, err)
+	}
+	_ = store.Put(testValidator, newTestVote(walTestVoteAddr, 12, 13))
+	if got := fmt.Sprint(rangeTargets(0, 100)); got != "[12 13 14 15 16]" {
+		t.Error("range after prune, got", got)
+	}
+}
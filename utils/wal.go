@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const walSuffix = ".wal"
+
+// voteWAL is an append-only log per validator of every vote accepted by the
+// VotesRecordStore, so the store can be rebuilt after a crash or kill -9.
+// Writes go to the page cache without fsync, which survives a process crash
+// but not a power loss; checkpoints are synced.
+type voteWAL struct {
+	dir   string
+	mu    sync.Mutex
+	files map[types.BLSPublicKey]*os.File
+	// pending holds, during a checkpoint, the votes appended since the
+	// snapshot of each validator whose log is still to be rewritten
+	pending map[types.BLSPublicKey][]*StoredVote
+}
+
+func newVoteWAL(dir string) (*voteWAL, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &voteWAL{
+		dir:   dir,
+		files: make(map[types.BLSPublicKey]*os.File),
+	}, nil
+}
+
+func (w *voteWAL) path(voteAddr types.BLSPublicKey) string {
+	return path.Join(w.dir, hex.EncodeToString(voteAddr.Bytes())+walSuffix)
+}
+
+func (w *voteWAL) file(voteAddr types.BLSPublicKey) (*os.File, error) {
+	if f, ok := w.files[voteAddr]; ok {
+		return f, nil
+	}
+	f, err := os.OpenFile(w.path(voteAddr), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err != nil || info.Size() == 0 {
+		if _, err := f.Write(encodeVoteFileHeader()); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	w.files[voteAddr] = f
+	return f, nil
+}
+
+func (w *voteWAL) append(voteAddr types.BLSPublicKey, r *StoredVote) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	f, err := w.file(voteAddr)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if pending, ok := w.pending[voteAddr]; ok {
+		w.pending[voteAddr] = append(pending, r)
+	}
+	return nil
+}
+
+// replay hands every record in the log directory to fn.
+func (w *voteWAL) replay(fn func(types.BLSPublicKey, *StoredVote)) error {
+	files, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasSuffix(name, walSuffix) {
+			continue
+		}
+		keyBytes, err := hex.DecodeString(strings.TrimSuffix(name, walSuffix))
+		if err != nil || len(keyBytes) != types.BLSPublicKeyLength {
+			continue
+		}
+		var voteAddr types.BLSPublicKey
+		copy(voteAddr[:], keyBytes)
+		if err := readVoteFile(path.Join(w.dir, name), func(r *StoredVote) { fn(voteAddr, r) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// begin starts a checkpoint of the logs of voteAddrs, whose snapshot the
+// caller took while no vote could be appended.
+func (w *voteWAL) begin(voteAddrs []types.BLSPublicKey) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending = make(map[types.BLSPublicKey][]*StoredVote, len(voteAddrs))
+	for _, voteAddr := range voteAddrs {
+		w.pending[voteAddr] = nil
+	}
+}
+
+// end finishes the checkpoint started by begin.
+func (w *voteWAL) end() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending = nil
+}
+
+// rewrite atomically replaces the log of voteAddr with records, its snapshot
+// taken at begin. It is how a checkpoint truncates the entries that have been
+// pruned from memory. The file is written and synced without holding the lock,
+// so appends are not blocked; the votes appended meanwhile are added before it
+// replaces the log.
+func (w *voteWAL) rewrite(voteAddr types.BLSPublicKey, records []*StoredVote) error {
+	tmpPath := w.path(voteAddr) + ".tmp"
+	if err := writeVoteFile(tmpPath, records); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	pending, ok := w.pending[voteAddr]
+	if !ok {
+		// the log was removed since the snapshot
+		return os.Remove(tmpPath)
+	}
+	delete(w.pending, voteAddr)
+	if len(pending) > 0 {
+		if err := appendVoteFile(tmpPath, pending); err != nil {
+			_ = os.Remove(tmpPath)
+			return err
+		}
+	}
+	if f, ok := w.files[voteAddr]; ok {
+		_ = f.Close()
+		delete(w.files, voteAddr)
+	}
+	return os.Rename(tmpPath, w.path(voteAddr))
+}
+
+// remove deletes the log of voteAddr, once all its votes have been pruned.
+func (w *voteWAL) remove(voteAddr types.BLSPublicKey) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if f, ok := w.files[voteAddr]; ok {
+		_ = f.Close()
+		delete(w.files, voteAddr)
+	}
+	delete(w.pending, voteAddr)
+	if err := os.Remove(w.path(voteAddr)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (w *voteWAL) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var err error
+	for voteAddr, f := range w.files {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(w.files, voteAddr)
+	}
+	return err
+}
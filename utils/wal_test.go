@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const walTestVoteAddr = "b32d4d46a7127dcc865f0d30f2ee3dcd5983b686f4e3a9202afc8b608652001c9938906ae1ff1417486096e32511f1bc"
+
+var testValidator = common.HexToAddress("0x91D7deA99716Cbb247E81F1cfB692009164a967E")
+
+func newTestVote(voteAddr string, srcNum, tarNum uint64) *types.VoteEnvelope {
+	return &types.VoteEnvelope{
+		VoteAddress: newBLSPubKey(voteAddr),
+		Data: &types.VoteData{
+			SourceNumber: srcNum,
+			SourceHash:   common.BigToHash(common.Big1),
+			TargetNumber: tarNum,
+			TargetHash:   common.BigToHash(common.Big2),
+		},
+	}
+}
+
+func TestVotesRecordStoreReplay(t *testing.T) {
+	dir := t.TempDir()
+	vrStore, err := NewVotesRecordStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for tarNum := uint64(10); tarNum < 15; tarNum++ {
+		if ok, _ := CheckVote(newTestVote(walTestVoteAddr, tarNum-1, tarNum), testValidator, vrStore); !ok {
+			t.Fatal("unexpected violation at", tarNum)
+		}
+	}
+	// simulate a crash: no Close, plus a torn write at the tail of the log
+	voteAddr := newBLSPubKey(walTestVoteAddr)
+	f, err := os.OpenFile(vrStore.wal.path(voteAddr), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"Height":15,"Vote":{"VoteAdd`)
+	_ = f.Close()
+
+	restored, err := NewVotesRecordStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	if n := len(restored.VoteRecord[voteAddr]); n != 5 {
+		t.Fatal("replayed votes, want 5 got", n)
+	}
+	if vote, _ := restored.Get(voteAddr, 12); vote == nil || vote.Validator != testValidator {
+		t.Error("validator tag not replayed", vote)
+	}
+	if ok, _ := CheckVote(newTestVote(walTestVoteAddr, 9, 12), testValidator, restored); ok {
+		t.Error("double vote against replayed history not detected")
+	}
+}
+
+func TestVotesRecordStoreCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	vrStore, err := NewVotesRecordStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for tarNum := uint64(1); tarNum <= 300; tarNum++ {
+		CheckVote(newTestVote(walTestVoteAddr, tarNum-1, tarNum), testValidator, vrStore)
+	}
+	if err := vrStore.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var replayed int
+	err = readVoteFile(path.Join(dir, walTestVoteAddr+walSuffix), func(*StoredVote) { replayed++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := len(vrStore.VoteRecord[newBLSPubKey(walTestVoteAddr)]); replayed != want {
+		t.Errorf("checkpoint kept %d entries, want %d", replayed, want)
+	}
+}
+
+func TestVotesRecordStorePruneEmpty(t *testing.T) {
+	dir := t.TempDir()
+	vrStore, err := NewVotesRecordStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vrStore.Close()
+	const otherVoteAddr = "a4fa3c5cf2e4a1d3e4e1bf8f3c2b2d6fb9e4b0ac44c06f2ab5b3e4ed0b7c6fc1d6ae4c2e3b1f70c3d8e2b4f6c5a3e1d9"
+	_ = vrStore.Put(testValidator, newTestVote(walTestVoteAddr, 9, 10))
+	_ = vrStore.Put(testValidator, newTestVote(otherVoteAddr, 19, 20))
+	if err := vrStore.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	if pruned, err := vrStore.PruneBelow(15); err != nil || pruned != 1 {
+		t.Fatal("pruned", pruned, err)
+	}
+	voteAddr := newBLSPubKey(walTestVoteAddr)
+	if _, ok := vrStore.VoteRecord[voteAddr]; ok {
+		t.Error("empty history kept")
+	}
+	if _, ok := vrStore.validators[voteAddr]; ok {
+		t.Error("validator of empty history kept")
+	}
+	if _, err := os.Stat(path.Join(dir, walTestVoteAddr+walSuffix)); !os.IsNotExist(err) {
+		t.Error("log of empty history kept", err)
+	}
+	if _, err := os.Stat(path.Join(dir, otherVoteAddr+walSuffix)); err != nil {
+		t.Error("log of remaining history removed", err)
+	}
+}
+
+func TestVoteWALRewriteKeepsAppends(t *testing.T) {
+	wal, err := newVoteWAL(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.close()
+	voteAddr := newBLSPubKey(walTestVoteAddr)
+	snapshot := []*StoredVote{{Height: 10, Vote: newTestVote(walTestVoteAddr, 9, 10)}}
+
+	// a vote appended between the snapshot and the rewrite survives it
+	wal.begin([]types.BLSPublicKey{voteAddr})
+	if err := wal.append(voteAddr, &StoredVote{Height: 11, Vote: newTestVote(walTestVoteAddr, 10, 11)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.rewrite(voteAddr, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	wal.end()
+
+	var heights []uint64
+	if err := readVoteFile(wal.path(voteAddr), func(r *StoredVote) { heights = append(heights, r.Height) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(heights) != 2 || heights[0] != 10 || heights[1] != 11 {
+		t.Error("rewritten log holds", heights)
+	}
+}